@@ -1,12 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/robertlestak/sigc/internal/cache"
 	"github.com/robertlestak/sigc/internal/server"
 	"github.com/robertlestak/sigc/internal/worker"
+	"github.com/robertlestak/sigc/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,8 +18,12 @@ func init() {
 		ll = log.InfoLevel
 	}
 	log.SetLevel(ll)
-	if err := cache.Init(); err != nil {
-		log.Fatal(err)
+}
+
+// printParams prints the connection params of every driver as markdown.
+func printParams() {
+	for _, d := range schema.Drivers() {
+		fmt.Printf("### %s\n\n%s\n", d, schema.ParamsMarkdown(d))
 	}
 }
 
@@ -32,6 +38,13 @@ func main() {
 	if len(os.Args) > 1 {
 		arg = os.Args[1]
 	}
+	if arg == "params" {
+		printParams()
+		return
+	}
+	if err := cache.Init(); err != nil {
+		l.Fatal(err)
+	}
 	if arg == "worker" {
 		worker.Start()
 	} else {
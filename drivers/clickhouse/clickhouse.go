@@ -0,0 +1,235 @@
+package clickhouse
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	ch "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+)
+
+// Params are the connection params accepted by the clickhouse driver.
+var Params = []schema.ConnectionParam{
+	{Name: "host", Type: schema.ParamString, Required: true, Description: "The host to connect to."},
+	{Name: "port", Type: schema.ParamInt, Required: true, Description: "The port to connect to, for example `9000` for the native protocol or `8123` for HTTP."},
+	{Name: "user", Type: schema.ParamString, Required: true, Description: "The username to use when connecting to ClickHouse."},
+	{Name: "pass", Type: schema.ParamString, Secret: true, Description: "The password to use when connecting to ClickHouse."},
+	{Name: "db", Type: schema.ParamString, Required: true, Description: "The database to use when connecting to ClickHouse."},
+	{Name: "protocol", Type: schema.ParamString, Default: "native", Description: "The protocol to use, `native` or `http`."},
+	{Name: "tls", Type: schema.ParamBool, Default: false, Description: "Connect to ClickHouse over TLS."},
+	{Name: "max_execution_time", Type: schema.ParamInt, Description: "The `max_execution_time` setting, in seconds, applied to every statement."},
+	{Name: "readonly", Type: schema.ParamInt, Description: "The `readonly` setting applied to every statement, `0`, `1` or `2`."},
+}
+
+func init() {
+	schema.RegisterDriverParams("clickhouse", Params)
+}
+
+type ClickHouse struct {
+	Client           *sql.DB
+	Host             string
+	Port             string
+	User             string
+	Pass             string
+	Db               string
+	Protocol         string
+	TLS              bool
+	MaxExecutionTime int
+	Readonly         int
+}
+
+func (d *ClickHouse) parseParams(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "clickhouse",
+		"fn":  "parseParams",
+	})
+	l.Debug("start")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
+	}
+	d.Host = p.String("host")
+	if d.Port, err = p.Port("port"); err != nil {
+		return err
+	}
+	d.User = p.String("user")
+	d.Pass = p.String("pass")
+	d.Db = p.String("db")
+	d.Protocol = p.String("protocol")
+	switch d.Protocol {
+	case "native", "http":
+	default:
+		return fmt.Errorf("protocol must be native or http")
+	}
+	d.TLS = p.Bool("tls")
+	if d.MaxExecutionTime = p.Int("max_execution_time"); d.MaxExecutionTime < 0 {
+		return fmt.Errorf("max_execution_time must be equal or greater than 0")
+	}
+	if d.Readonly = p.Int("readonly"); d.Readonly < 0 || d.Readonly > 2 {
+		return fmt.Errorf("readonly must be 0, 1 or 2")
+	}
+	return nil
+}
+
+func (d *ClickHouse) Connect(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "clickhouse",
+		"fn":  "Connect",
+	})
+	l.Debug("start")
+	if err := d.parseParams(params); err != nil {
+		return err
+	}
+	opts := &ch.Options{
+		Addr: []string{net.JoinHostPort(d.Host, d.Port)},
+		Auth: ch.Auth{
+			Database: d.Db,
+			Username: d.User,
+			Password: d.Pass,
+		},
+		Settings:    ch.Settings{},
+		DialTimeout: time.Second * 10,
+	}
+	if d.Protocol == "http" {
+		opts.Protocol = ch.HTTP
+	}
+	if d.TLS {
+		opts.TLS = &tls.Config{ServerName: d.Host}
+	}
+	if d.MaxExecutionTime > 0 {
+		opts.Settings["max_execution_time"] = d.MaxExecutionTime
+	}
+	if d.Readonly > 0 {
+		opts.Settings["readonly"] = d.Readonly
+	}
+	d.Client = ch.OpenDB(opts)
+	if err := d.Client.Ping(); err != nil {
+		l.Error(err)
+		d.Client.Close()
+		return err
+	}
+	l.Debug("Connected")
+	return nil
+}
+
+func (d *ClickHouse) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": "clickhouse",
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	err := d.Client.Close()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debug("Disconnected")
+	return nil
+}
+
+// toJSONValue converts a ClickHouse value into a value which encodes
+// naturally as JSON. As in ClickHouse's own JSON output formats, 64 bit and
+// wider integers are returned as strings so they survive JSON parsers which
+// use float64 numbers. Decimals are returned as strings to keep their
+// precision.
+func toJSONValue(v any) any {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case big.Int:
+		return t.String()
+	case *big.Int:
+		if t == nil {
+			return nil
+		}
+		return t.String()
+	case decimal.Decimal:
+		return t.String()
+	case time.Time:
+		return t
+	case net.IP:
+		return t.String()
+	case []byte:
+		return string(t)
+	case fmt.Stringer:
+		return t.String()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+		return toJSONValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = toJSONValue(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(toJSONValue(iter.Key().Interface()))] = toJSONValue(iter.Value().Interface())
+		}
+		return out
+	}
+	return v
+}
+
+// rowsToMapSlice maps rows into result rows with JSON friendly values.
+func rowsToMapSlice(rows *sql.Rows) ([]map[string]any, error) {
+	m, err := utils.RowsToMapSlice(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range m {
+		for k, v := range row {
+			row[k] = toJSONValue(v)
+		}
+	}
+	return m, nil
+}
+
+func (d *ClickHouse) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "clickhouse",
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	var err error
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	stmt, params, err := utils.ExpandArrays(r.Statement, r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	sets, err := schema.QueryResultSets(d.Client, false, stmt, params, rowsToMapSlice)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.SetResultSets(sets)
+	return res
+}
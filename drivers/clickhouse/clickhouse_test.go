@@ -0,0 +1,68 @@
+package clickhouse
+
+import (
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestToJSONValue(t *testing.T) {
+	uint256, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	int128, _ := new(big.Int).SetString("-170141183460469231731687303715884105728", 10)
+	day := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	s := "a"
+	var nilString *string
+	var nilBig *big.Int
+	tests := []struct {
+		name string
+		v    any
+		want any
+	}{
+		{"nil", nil, nil},
+		{"string", "a", "a"},
+		{"bool", true, true},
+		{"uint8", uint8(255), uint8(255)},
+		{"int32", int32(-7), int32(-7)},
+		{"float64", 1.5, 1.5},
+		{"int64", int64(math.MinInt64), "-9223372036854775808"},
+		{"uint64", uint64(math.MaxUint64), "18446744073709551615"},
+		{"int128", int128, "-170141183460469231731687303715884105728"},
+		{"uint256", uint256, uint256.String()},
+		{"big int value", *big.NewInt(42), "42"},
+		{"nil big int", nilBig, nil},
+		{"decimal", decimal.RequireFromString("12345678901234567890.123456789"), "12345678901234567890.123456789"},
+		{"decimal trailing zeros", decimal.New(1500, -3), "1.5"},
+		{"date", day, day},
+		{"datetime64", ts, ts},
+		{"ipv4", net.ParseIP("10.0.0.1").To4(), "10.0.0.1"},
+		{"ipv6", net.ParseIP("::1"), "::1"},
+		{"uuid", uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{"fixed string", []byte("ab"), "ab"},
+		{"nullable", &s, "a"},
+		{"nullable null", nilString, nil},
+		{"array of strings", []string{"a", "b"}, []any{"a", "b"}},
+		{"array of uint64", []uint64{1, math.MaxUint64}, []any{"1", "18446744073709551615"}},
+		{"array of nullable", []*string{&s, nil}, []any{"a", nil}},
+		{"nested array", [][]int64{{1}, {2, 3}}, []any{[]any{"1"}, []any{"2", "3"}}},
+		{"empty array", []int32{}, []any{}},
+		{"tuple", []any{"a", int64(1), decimal.New(5, -1)}, []any{"a", "1", "0.5"}},
+		{"map", map[string]uint64{"a": 1}, map[string]any{"a": "1"}},
+		{"map int keys", map[int64]string{-1: "a"}, map[string]any{"-1": "a"}},
+		{"map of arrays", map[string][]decimal.Decimal{"a": {decimal.New(1, 0)}}, map[string]any{"a": []any{"1"}}},
+		{"map of dates", map[string]time.Time{"a": day}, map[string]any{"a": day}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toJSONValue(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toJSONValue(%#v) = %#v, want %#v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBodySize is the largest upstream response body which will be read.
+const maxBodySize = 10 << 20
+
+// placeholderRe matches a positional $N placeholder in a template value.
+var placeholderRe = regexp.MustCompile(`\$([0-9]+)`)
+
+// Params are the connection params accepted by the http driver.
+var Params = []schema.ConnectionParam{
+	{Name: "base_url", Type: schema.ParamString, Required: true, Description: "The base URL of the upstream service, for example `https://orders.internal/api`. Requests can only be made to paths under this URL."},
+	{Name: "headers", Type: schema.ParamMap, Secret: true, Description: "A map of headers to send with every request."},
+	{Name: "bearer_token", Type: schema.ParamString, Secret: true, Description: "A bearer token to send in the `Authorization` header."},
+	{Name: "user", Type: schema.ParamString, Description: "The username to use for basic authentication, if no `bearer_token` is set."},
+	{Name: "pass", Type: schema.ParamString, Secret: true, Description: "The password to use for basic authentication."},
+	{Name: "timeout", Type: schema.ParamInt, Default: 30, Description: "The request timeout in seconds."},
+}
+
+func init() {
+	schema.RegisterDriverParams("http", Params)
+}
+
+type HTTP struct {
+	Client      *nethttp.Client
+	BaseURL     *url.URL
+	Headers     map[string]string
+	BearerToken string
+	User        string
+	Pass        string
+	Timeout     int
+}
+
+// Template is the request template signed as the statement of an HTTP
+// request.
+type Template struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Query    map[string]string `json:"query,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     any               `json:"body,omitempty"`
+	Response string            `json:"response,omitempty"`
+}
+
+func (d *HTTP) parseParams(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "http",
+		"fn":  "parseParams",
+	})
+	l.Debug("start")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
+	}
+	d.BaseURL, err = url.Parse(p.String("base_url"))
+	if err != nil || d.BaseURL.Host == "" {
+		return fmt.Errorf("base_url must be an absolute URL")
+	}
+	if d.BaseURL.Scheme != "http" && d.BaseURL.Scheme != "https" {
+		return fmt.Errorf("base_url must be an http or https URL")
+	}
+	d.Headers = p.Map("headers")
+	d.BearerToken = p.String("bearer_token")
+	d.User = p.String("user")
+	d.Pass = p.String("pass")
+	d.Timeout = p.Int("timeout")
+	return nil
+}
+
+func (d *HTTP) Connect(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "http",
+		"fn":  "Connect",
+	})
+	l.Debug("start")
+	if err := d.parseParams(params); err != nil {
+		return err
+	}
+	d.Client = &nethttp.Client{
+		Timeout: time.Duration(d.Timeout) * time.Second,
+		// redirects could otherwise leave the signed base_url
+		CheckRedirect: func(req *nethttp.Request, via []*nethttp.Request) error {
+			return nethttp.ErrUseLastResponse
+		},
+	}
+	l.Debug("Connected")
+	return nil
+}
+
+func (d *HTTP) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": "http",
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	d.Client.CloseIdleConnections()
+	l.Debug("Disconnected")
+	return nil
+}
+
+// ParseTemplate parses a JSON request template.
+func ParseTemplate(statement string) (*Template, error) {
+	t := &Template{}
+	if err := json.Unmarshal([]byte(statement), t); err != nil {
+		return nil, fmt.Errorf("statement must be a JSON request template: %w", err)
+	}
+	if t.Method == "" {
+		t.Method = nethttp.MethodGet
+	}
+	t.Method = strings.ToUpper(t.Method)
+	switch t.Response {
+	case "":
+		t.Response = "body"
+	case "body", "full":
+	default:
+		return nil, fmt.Errorf("response must be body or full")
+	}
+	return t, nil
+}
+
+// param returns the param of the placeholder ph. Params must be scalars or
+// arrays of scalars, so that a client cannot replace a signed value in the
+// body with an object of its own.
+func param(ph string, params []any) (any, error) {
+	n, _ := strconv.Atoi(ph[1:])
+	if n < 1 || n > len(params) {
+		return nil, fmt.Errorf("placeholder %s has no matching param", ph)
+	}
+	p := params[n-1]
+	if !utils.IsScalar(p) && !utils.IsScalarArray(p) {
+		return nil, fmt.Errorf("param %s must be a scalar or an array of scalars", ph)
+	}
+	return p, nil
+}
+
+func paramString(p any) string {
+	switch v := p.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(p)
+}
+
+// replaceString substitutes every $N placeholder in s with the string form
+// of its param, passed through escape. The params must be scalars.
+func replaceString(s string, params []any, escape func(string) (string, error)) (string, error) {
+	var err error
+	out := placeholderRe.ReplaceAllStringFunc(s, func(ph string) string {
+		p, perr := param(ph, params)
+		if perr == nil && !utils.IsScalar(p) {
+			perr = fmt.Errorf("param %s must be a scalar", ph)
+		}
+		if perr != nil {
+			err = perr
+			return ph
+		}
+		v, perr := escape(paramString(p))
+		if perr != nil {
+			err = perr
+			return ph
+		}
+		return v
+	})
+	return out, err
+}
+
+func noEscape(s string) (string, error) {
+	return s, nil
+}
+
+func pathEscape(s string) (string, error) {
+	if s == "." || s == ".." {
+		return "", fmt.Errorf("path params must not be . or ..")
+	}
+	return url.PathEscape(s), nil
+}
+
+func headerValue(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", fmt.Errorf("header params must not contain line breaks")
+	}
+	return s, nil
+}
+
+// substitute replaces $N placeholders in a decoded JSON body. A string that
+// is exactly a placeholder is replaced by the param value itself so its
+// JSON type is preserved. Only scalars and arrays of scalars are accepted,
+// so the shape of the signed body is kept.
+func substitute(v any, params []any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		if m := placeholderRe.FindString(t); m != "" && m == t {
+			return param(m, params)
+		}
+		return replaceString(t, params, noEscape)
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			sv, err := substitute(e, params)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = sv
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			sv, err := substitute(e, params)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = sv
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// cleanPath resolves the . and .. segments of the escaped path p and
+// returns an error if the result is not under the escaped base path.
+func cleanPath(base, p string) (string, error) {
+	base = path.Clean("/" + base)
+	cp := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cp != "/" {
+		cp += "/"
+	}
+	if base != "/" && cp != base && !strings.HasPrefix(cp, base+"/") {
+		return "", fmt.Errorf("path must be under the base_url path %s", base)
+	}
+	return cp, nil
+}
+
+// NewRequest builds the upstream request for a template and params.
+func (d *HTTP) NewRequest(t *Template, params []any) (*nethttp.Request, error) {
+	p, err := replaceString(t.Path, params, pathEscape)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(strings.TrimSuffix(d.BaseURL.EscapedPath(), "/") + "/" + strings.TrimPrefix(p, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if ref.IsAbs() || ref.Host != "" {
+		return nil, fmt.Errorf("path must be relative to base_url")
+	}
+	rp, err := cleanPath(d.BaseURL.EscapedPath(), ref.EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	u := *d.BaseURL
+	if u.Path, err = url.PathUnescape(rp); err != nil {
+		return nil, err
+	}
+	u.RawPath = rp
+	q := u.Query()
+	for k, v := range ref.Query() {
+		q[k] = append(q[k], v...)
+	}
+	for k, v := range t.Query {
+		qv, err := replaceString(v, params, noEscape)
+		if err != nil {
+			return nil, err
+		}
+		q.Add(k, qv)
+	}
+	u.RawQuery = q.Encode()
+	var body io.Reader
+	var contentType string
+	switch b := t.Body.(type) {
+	case nil:
+	case string:
+		s, err := replaceString(b, params, noEscape)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(s)
+		contentType = "text/plain; charset=utf-8"
+	default:
+		sb, err := substitute(b, params)
+		if err != nil {
+			return nil, err
+		}
+		jd, err := json.Marshal(sb)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(jd)
+		contentType = "application/json"
+	}
+	req, err := nethttp.NewRequest(t.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range d.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range t.Headers {
+		hv, err := replaceString(v, params, headerValue)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, hv)
+	}
+	if d.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+d.BearerToken)
+	} else if d.User != "" {
+		req.SetBasicAuth(d.User, d.Pass)
+	}
+	return req, nil
+}
+
+// decodeBody decodes a JSON response body, falling back to the raw text
+// for any other content.
+func decodeBody(b []byte) any {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	return v
+}
+
+// bodyToMapSlice maps a decoded body into result rows. Objects are
+// returned as a single row, arrays of objects as one row per object and
+// any other value as {"value": v} rows.
+func bodyToMapSlice(v any) []map[string]any {
+	switch t := v.(type) {
+	case map[string]any:
+		return []map[string]any{t}
+	case []any:
+		sm := make([]map[string]any, len(t))
+		for i, e := range t {
+			if m, ok := e.(map[string]any); ok {
+				sm[i] = m
+			} else {
+				sm[i] = map[string]any{"value": e}
+			}
+		}
+		return sm
+	case string:
+		return []map[string]any{{"body": t}}
+	}
+	return []map[string]any{{"value": v}}
+}
+
+func (d *HTTP) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "http",
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	t, err := ParseTemplate(r.Statement)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	req, err := d.NewRequest(t, r.Params)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err == nil && len(b) > maxBodySize {
+		err = fmt.Errorf("upstream response body is larger than %d bytes", maxBodySize)
+	}
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	var body any
+	if len(b) > 0 {
+		body = decodeBody(b)
+	}
+	if t.Response == "full" {
+		hdrs := make(map[string]any, len(resp.Header))
+		for k := range resp.Header {
+			hdrs[k] = resp.Header.Get(k)
+		}
+		res.Results = []map[string]any{{
+			"status":  resp.StatusCode,
+			"headers": hdrs,
+			"body":    body,
+		}}
+		return res
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("upstream returned %s", resp.Status)
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	if body != nil {
+		res.Results = bodyToMapSlice(body)
+	}
+	return res
+}
+
+// Prepare parses the request template and builds the request without
+// sending it, and returns the number of params it takes.
+func (d *HTTP) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "http",
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	t, err := ParseTemplate(statement)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	n := utils.MaxPlaceholder(statement)
+	params := make([]any, n)
+	for i := range params {
+		params[i] = "x"
+	}
+	if _, err := d.NewRequest(t, params); err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	return &schema.Probe{ParamCount: n}, nil
+}
@@ -0,0 +1,313 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+func TestNewRequestPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		path    string
+		params  []any
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "under base",
+			baseURL: "https://orders.internal/api",
+			path:    "/orders/$1",
+			params:  []any{"42"},
+			want:    "https://orders.internal/api/orders/42",
+		},
+		{
+			name:    "trailing slash",
+			baseURL: "https://orders.internal/api/",
+			path:    "orders/",
+			want:    "https://orders.internal/api/orders/",
+		},
+		{
+			name:    "dot segments inside base",
+			baseURL: "https://orders.internal/api",
+			path:    "/orders/../users/./1",
+			want:    "https://orders.internal/api/users/1",
+		},
+		{
+			name:    "escaped slash in param",
+			baseURL: "https://orders.internal/api",
+			path:    "/orders/$1",
+			params:  []any{"../admin"},
+			want:    "https://orders.internal/api/orders/..%2Fadmin",
+		},
+		{
+			name:    "dot dot escapes base",
+			baseURL: "https://orders.internal/api",
+			path:    "/../admin",
+			wantErr: true,
+		},
+		{
+			name:    "dot dot to sibling with base prefix",
+			baseURL: "https://orders.internal/api",
+			path:    "/../api-internal/keys",
+			wantErr: true,
+		},
+		{
+			name:    "dot dot param",
+			baseURL: "https://orders.internal/api",
+			path:    "/orders/$1",
+			params:  []any{".."},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bu, err := url.Parse(tt.baseURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &HTTP{BaseURL: bu}
+			req, err := d.NewRequest(&Template{Method: "GET", Path: tt.path}, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := req.URL.String(); got != tt.want {
+				t.Errorf("URL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// testServer returns a driver connected to an upstream which records the
+// last request it received, and responds with handler if it is set.
+func testServer(t *testing.T, handler nethttp.HandlerFunc) (*HTTP, *recorded) {
+	t.Helper()
+	rec := &recorded{}
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		b, _ := io.ReadAll(r.Body)
+		rec.method, rec.path, rec.query, rec.header, rec.body = r.Method, r.URL.EscapedPath(), r.URL.Query(), r.Header, b
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	d := &HTTP{}
+	if err := d.Connect(map[string]any{
+		"base_url":     srv.URL + "/api",
+		"headers":      map[string]any{"X-Static": "static"},
+		"bearer_token": "token",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Disconnect() })
+	return d, rec
+}
+
+type recorded struct {
+	method string
+	path   string
+	query  url.Values
+	header nethttp.Header
+	body   []byte
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		params    []any
+		wantErr   bool
+		check     func(t *testing.T, rec *recorded)
+	}{
+		{
+			name:      "get with path and query",
+			statement: `{"path": "/users/$1", "query": {"q": "$2"}}`,
+			params:    []any{"a b", float64(7)},
+			check: func(t *testing.T, rec *recorded) {
+				if rec.method != "GET" || rec.path != "/api/users/a%20b" || rec.query.Get("q") != "7" {
+					t.Errorf("got %s %s?%s", rec.method, rec.path, rec.query.Encode())
+				}
+			},
+		},
+		{
+			name:      "method headers and auth",
+			statement: `{"method": "delete", "path": "/users/1", "headers": {"X-Source": "$1"}}`,
+			params:    []any{"cli"},
+			check: func(t *testing.T, rec *recorded) {
+				if rec.method != "DELETE" {
+					t.Errorf("method = %s, want DELETE", rec.method)
+				}
+				if rec.header.Get("X-Source") != "cli" || rec.header.Get("X-Static") != "static" {
+					t.Errorf("headers = %v", rec.header)
+				}
+				if rec.header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Authorization = %q", rec.header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name:      "json body",
+			statement: `{"method": "POST", "path": "/orders", "body": {"sku": "$1", "qty": "$2", "tags": "$3", "note": "sku $1", "gift": "$4"}}`,
+			params:    []any{"A-1", float64(2), []any{"x", "y"}, nil},
+			check: func(t *testing.T, rec *recorded) {
+				var b map[string]any
+				if err := json.Unmarshal(rec.body, &b); err != nil {
+					t.Fatal(err)
+				}
+				if b["sku"] != "A-1" || b["qty"] != float64(2) || b["note"] != "sku A-1" || b["gift"] != nil {
+					t.Errorf("body = %s", rec.body)
+				}
+				if tags, ok := b["tags"].([]any); !ok || len(tags) != 2 {
+					t.Errorf("tags = %v", b["tags"])
+				}
+				if rec.header.Get("Content-Type") != "application/json" {
+					t.Errorf("Content-Type = %q", rec.header.Get("Content-Type"))
+				}
+			},
+		},
+		{
+			name:      "text body",
+			statement: `{"method": "PUT", "path": "/notes/1", "body": "note $1"}`,
+			params:    []any{true},
+			check: func(t *testing.T, rec *recorded) {
+				if string(rec.body) != "note true" || !strings.HasPrefix(rec.header.Get("Content-Type"), "text/plain") {
+					t.Errorf("body = %q, Content-Type = %q", rec.body, rec.header.Get("Content-Type"))
+				}
+			},
+		},
+		{
+			name:      "object param in body",
+			statement: `{"method": "POST", "path": "/users", "body": {"role": "$1"}}`,
+			params:    []any{map[string]any{"admin": true}},
+			wantErr:   true,
+		},
+		{
+			name:      "array of objects in body",
+			statement: `{"method": "POST", "path": "/users", "body": {"roles": "$1"}}`,
+			params:    []any{[]any{"user", map[string]any{"admin": true}}},
+			wantErr:   true,
+		},
+		{
+			name:      "array param in path",
+			statement: `{"path": "/users/$1"}`,
+			params:    []any{[]any{"a", "b"}},
+			wantErr:   true,
+		},
+		{
+			name:      "array param in header",
+			statement: `{"path": "/users", "headers": {"X-Ids": "$1"}}`,
+			params:    []any{[]any{"a"}},
+			wantErr:   true,
+		},
+		{
+			name:      "header injection",
+			statement: `{"path": "/users", "headers": {"X-Source": "$1"}}`,
+			params:    []any{"a\r\nX-Admin: true"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, rec := testServer(t, nil)
+			res := d.Exec(&schema.Request{Statement: tt.statement, Params: tt.params})
+			if (res.Error != nil) != tt.wantErr {
+				t.Fatalf("Exec() error = %v, wantErr %v", res.Error, tt.wantErr)
+			}
+			if res.Error != nil {
+				if rec.method != "" {
+					t.Errorf("rejected request was sent: %s %s", rec.method, rec.path)
+				}
+				return
+			}
+			if len(res.Results) != 1 || res.Results[0]["ok"] != true {
+				t.Errorf("results = %v", res.Results)
+			}
+			tt.check(t, rec)
+		})
+	}
+}
+
+func TestExecResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		handler   nethttp.HandlerFunc
+		wantErr   bool
+		want      int
+	}{
+		{
+			name:      "array body",
+			statement: `{"path": "/users"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.Write([]byte(`[{"id":1},{"id":2},3]`))
+			},
+			want: 3,
+		},
+		{
+			name:      "error status",
+			statement: `{"path": "/users"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.WriteHeader(nethttp.StatusNotFound)
+			},
+			wantErr: true,
+		},
+		{
+			name:      "error status in full response",
+			statement: `{"path": "/users", "response": "full"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.WriteHeader(nethttp.StatusNotFound)
+			},
+			want: 1,
+		},
+		{
+			name:      "body at the limit",
+			statement: `{"path": "/blob"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.Write(bytes.Repeat([]byte("a"), maxBodySize))
+			},
+			want: 1,
+		},
+		{
+			name:      "oversized body",
+			statement: `{"path": "/blob"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.Write(bytes.Repeat([]byte("a"), maxBodySize+1))
+			},
+			wantErr: true,
+		},
+		{
+			name:      "oversized body in full response",
+			statement: `{"path": "/blob", "response": "full"}`,
+			handler: func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.Write(bytes.Repeat([]byte("a"), maxBodySize+1))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := testServer(t, tt.handler)
+			res := d.Exec(&schema.Request{Statement: tt.statement})
+			if (res.Error != nil) != tt.wantErr {
+				t.Fatalf("Exec() error = %v, wantErr %v", res.Error, tt.wantErr)
+			}
+			if res.Error == nil && len(res.Results) != tt.want {
+				t.Errorf("got %d results, want %d", len(res.Results), tt.want)
+			}
+		})
+	}
+}
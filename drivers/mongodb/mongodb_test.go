@@ -0,0 +1,199 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseCommandParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		params    []any
+		wantErr   bool
+	}{
+		{
+			name:      "string",
+			statement: `{"find": "users", "filter": {"name": "$1"}}`,
+			params:    []any{"alice"},
+		},
+		{
+			name:      "number bool and null",
+			statement: `{"find": "users", "filter": {"age": "$1", "active": "$2", "deleted_at": "$3"}}`,
+			params:    []any{float64(30), true, nil},
+		},
+		{
+			name:      "array of scalars",
+			statement: `{"find": "users", "filter": {"_id": {"$in": "$1"}}}`,
+			params:    []any{[]any{"a", float64(1)}},
+		},
+		{
+			name:      "operator object in filter",
+			statement: `{"find": "users", "filter": {"name": "$1"}}`,
+			params:    []any{map[string]any{"$ne": nil}},
+			wantErr:   true,
+		},
+		{
+			name:      "operator object in update",
+			statement: `{"updateMany": "users", "filter": {"name": "$1"}, "update": {"$set": {"role": "$2"}}}`,
+			params:    []any{"alice", map[string]any{"$literal": "admin"}},
+			wantErr:   true,
+		},
+		{
+			name:      "operator object in array",
+			statement: `{"find": "users", "filter": {"_id": {"$in": "$1"}}}`,
+			params:    []any{[]any{map[string]any{"$gt": ""}}},
+			wantErr:   true,
+		},
+		{
+			name:      "nested array",
+			statement: `{"find": "users", "filter": {"_id": {"$in": "$1"}}}`,
+			params:    []any{[]any{[]any{"a"}}},
+			wantErr:   true,
+		},
+		{
+			name:      "missing param",
+			statement: `{"find": "users", "filter": {"name": "$2"}}`,
+			params:    []any{"alice"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCommand(tt.statement, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCommandSubstitutes(t *testing.T) {
+	c, err := ParseCommand(`{"find": "users", "filter": {"name": "$1", "note": "id $2"}}`, []any{"alice", float64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Op != "find" || c.Collection != "users" {
+		t.Fatalf("got op %q collection %q", c.Op, c.Collection)
+	}
+	filter, ok := c.Args["filter"].(bson.D)
+	if !ok {
+		t.Fatalf("filter is %T", c.Args["filter"])
+	}
+	m := filter.Map()
+	if m["name"] != "alice" {
+		t.Errorf("name = %v, want alice", m["name"])
+	}
+	if m["note"] != "id 7" {
+		t.Errorf("note = %v, want id 7", m["note"])
+	}
+}
+
+func TestExecRejectsNonScalarParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		params    []any
+	}{
+		{
+			name:      "operator object",
+			statement: `{"find": "users", "filter": {"name": "$1"}}`,
+			params:    []any{map[string]any{"$ne": nil}},
+		},
+		{
+			name:      "operator object in embedded placeholder",
+			statement: `{"find": "users", "filter": {"name": "$1", "org": "$2"}}`,
+			params:    []any{"alice", map[string]any{"$gt": ""}},
+		},
+		{
+			name:      "array of objects",
+			statement: `{"find": "users", "filter": {"_id": {"$in": "$1"}}}`,
+			params:    []any{[]any{"a", map[string]any{"$exists": true}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the params are rejected before the client is used
+			d := &MongoDB{}
+			res := d.Exec(&schema.Request{Statement: tt.statement, Params: tt.params})
+			if res.Error == nil || !strings.Contains(res.Error.Error(), "scalar") {
+				t.Fatalf("Exec() error = %v, want a scalar param error", res.Error)
+			}
+			if res.Results != nil {
+				t.Errorf("Exec() results = %v, want none", res.Results)
+			}
+		})
+	}
+}
+
+// TestIntegration runs against the MongoDB server in MONGODB_TEST_URI, and
+// is skipped if it is not set. MONGODB_TEST_DB defaults to sigc_test.
+func TestIntegration(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+	db := os.Getenv("MONGODB_TEST_DB")
+	if db == "" {
+		db = "sigc_test"
+	}
+	d := &MongoDB{}
+	if err := d.Connect(map[string]any{"uri": uri, "db": db}); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+	coll := fmt.Sprintf("users_%d", time.Now().UnixNano())
+	defer d.Client.Database(db).Collection(coll).Drop(context.Background())
+	exec := func(statement string, params ...any) *schema.Response {
+		t.Helper()
+		return d.Exec(&schema.Request{Statement: strings.ReplaceAll(statement, "COLL", coll), Params: params})
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if res := exec(`{"insertOne": "COLL", "document": {"name": "$1", "age": "$2"}}`, name, float64(30)); res.Error != nil {
+			t.Fatal(res.Error)
+		}
+	}
+	tests := []struct {
+		name      string
+		statement string
+		params    []any
+		want      int
+		wantErr   bool
+	}{
+		{"find by name", `{"find": "COLL", "filter": {"name": "$1"}}`, []any{"alice"}, 1, false},
+		{"find in", `{"find": "COLL", "filter": {"name": {"$in": "$1"}}}`, []any{[]any{"alice", "bob"}}, 2, false},
+		{"operator injection", `{"find": "COLL", "filter": {"name": "$1"}}`, []any{map[string]any{"$ne": nil}}, 0, true},
+		{"update", `{"updateMany": "COLL", "filter": {"name": "$1"}, "update": {"$set": {"age": "$2"}}}`, []any{"bob", float64(31)}, 1, false},
+		{"update injection", `{"updateMany": "COLL", "filter": {"name": "$1"}, "update": {"$set": {"age": "$2"}}}`, []any{"bob", map[string]any{"$literal": 1}}, 0, true},
+		{"delete", `{"deleteOne": "COLL", "filter": {"name": "$1"}}`, []any{"alice"}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := exec(tt.statement, tt.params...)
+			if (res.Error != nil) != tt.wantErr {
+				t.Fatalf("Exec() error = %v, wantErr %v", res.Error, tt.wantErr)
+			}
+			if res.Error != nil {
+				return
+			}
+			got := len(res.Results)
+			if r := res.Results; len(r) == 1 {
+				if n, ok := r[0]["modified_count"].(int64); ok {
+					got = int(n)
+				} else if n, ok := r[0]["deleted_count"].(int64); ok {
+					got = int(n)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("Exec() = %v, want %d", res.Results, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,37 @@
 package mssql
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
 
-	_ "github.com/denisenkom/go-mssqldb"
+	gomssql "github.com/denisenkom/go-mssqldb"
 	"github.com/robertlestak/sigc/internal/utils"
 	"github.com/robertlestak/sigc/pkg/schema"
+	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 )
 
+// Params are the connection params accepted by the mssql driver.
+var Params = []schema.ConnectionParam{
+	{Name: "host", Type: schema.ParamString, Required: true, Description: "The host to connect to."},
+	{Name: "port", Type: schema.ParamInt, Required: true, Description: "The port to connect to."},
+	{Name: "user", Type: schema.ParamString, Required: true, Description: "The username to use when connecting to MSSQL."},
+	{Name: "pass", Type: schema.ParamString, Required: true, Secret: true, Description: "The password to use when connecting to MSSQL."},
+	{Name: "db", Type: schema.ParamString, Required: true, Description: "The database to use when connecting to MSSQL."},
+}
+
+func init() {
+	schema.RegisterDriverParams("mssql", Params)
+}
+
 type MSSql struct {
 	Client *sql.DB
 	Host   string
@@ -17,6 +39,11 @@ type MSSql struct {
 	User   string
 	Pass   string
 	Db     string
+
+	// callClient is used by Call. It is opened with the sqlserver driver,
+	// which does not parse the query text for placeholders, so a bare
+	// procedure name can take named params.
+	callClient *sql.DB
 }
 
 func (d *MSSql) parseParams(params map[string]any) error {
@@ -25,26 +52,17 @@ func (d *MSSql) parseParams(params map[string]any) error {
 		"fn":  "parseParams",
 	})
 	l.Debug("start")
-	if params["host"] == nil {
-		return fmt.Errorf("host is required")
-	}
-	d.Host = params["host"].(string)
-	if params["port"] == nil {
-		return fmt.Errorf("port is required")
-	}
-	d.Port = params["port"].(string)
-	if params["user"] == nil {
-		return fmt.Errorf("user is required")
-	}
-	d.User = params["user"].(string)
-	if params["pass"] == nil {
-		return fmt.Errorf("pass is required")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
 	}
-	d.Pass = params["pass"].(string)
-	if params["db"] == nil {
-		return fmt.Errorf("db is required")
+	d.Host = p.String("host")
+	if d.Port, err = p.Port("port"); err != nil {
+		return err
 	}
-	d.Db = params["db"].(string)
+	d.User = p.String("user")
+	d.Pass = p.String("pass")
+	d.Db = p.String("db")
 	return nil
 }
 
@@ -58,9 +76,16 @@ func (d *MSSql) Connect(params map[string]any) error {
 		return err
 	}
 	var err error
-	connStr := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%s;database=%s", d.Host, d.User, d.Pass, d.Port, d.Db)
-	l.Debug("Connecting to mssql: ", connStr)
-	d.Client, err = sql.Open("mssql", connStr)
+	q := url.Values{}
+	q.Set("database", d.Db)
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(d.User, d.Pass),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		RawQuery: q.Encode(),
+	}
+	l.Debugf("Connecting to mssql: %s/%s", u.Host, d.Db)
+	d.Client, err = sql.Open("mssql", u.String())
 	if err != nil {
 		l.Error(err)
 		return err
@@ -72,6 +97,12 @@ func (d *MSSql) Connect(params map[string]any) error {
 		l.Error(err)
 		return err
 	}
+	d.callClient, err = sql.Open("sqlserver", u.String())
+	if err != nil {
+		l.Error(err)
+		d.Client.Close()
+		return err
+	}
 	l.Debug("Connected")
 	return nil
 }
@@ -83,6 +114,11 @@ func (d *MSSql) Disconnect() error {
 	})
 	l.Debug("start")
 	err := d.Client.Close()
+	if d.callClient != nil {
+		if cerr := d.callClient.Close(); err == nil {
+			err = cerr
+		}
+	}
 	if err != nil {
 		l.Error(err)
 		return err
@@ -100,7 +136,15 @@ func (d *MSSql) Exec(r *schema.Request) *schema.Response {
 	var err error
 	res := &schema.Response{}
 	l.Debug("Executing statement: ", r.Statement)
-	resp, err := d.Client.Query(r.Statement, r.Params...)
+	stmt, params, err := utils.ExpandArrays(r.Statement, r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	sets, err := schema.QueryResultSets(d.Client, r.Options.Transaction, stmt, params, utils.RowsToMapSlice)
 	if err != nil {
 		l.Error(err)
 		return &schema.Response{
@@ -108,8 +152,236 @@ func (d *MSSql) Exec(r *schema.Request) *schema.Response {
 			Error:   err,
 		}
 	}
-	defer resp.Close()
-	m, err := utils.RowsToMapSlice(resp)
+	res.SetResultSets(sets)
+	return res
+}
+
+// namedParams rewrites the ? and $N placeholders accepted by Exec into the
+// @pN form SQL Server expects, leaving quoted strings and identifiers as is.
+func namedParams(statement string) string {
+	var b strings.Builder
+	var quote rune
+	n := 0
+	rs := []rune(statement)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '?':
+			n++
+			b.WriteString("@p" + strconv.Itoa(n))
+			continue
+		case r == '$' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			b.WriteString("@p")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Prepare asks the server to describe the statement's params without
+// executing it, and returns their number and inferred types.
+func (d *MSSql) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "mssql",
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	rows, err := d.Client.Query("EXEC sp_describe_undeclared_parameters @tsql = ?", namedParams(statement))
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+	m, err := utils.RowsToMapSlice(rows)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	p := &schema.Probe{ParamCount: len(m)}
+	for _, r := range m {
+		p.ParamTypes = append(p.ParamTypes, fmt.Sprint(r["suggested_system_type_name"]))
+	}
+	return p, nil
+}
+
+// Retryable reports whether err is a deadlock (1205), after which the
+// statement can be run again.
+func (d *MSSql) Retryable(err error) bool {
+	var msErr gomssql.Error
+	if !errors.As(err, &msErr) {
+		return false
+	}
+	return msErr.Number == 1205
+}
+
+// maxDecimalLen is the length of the longest decimal(38) value, with its
+// sign and decimal point.
+const maxDecimalLen = 40
+
+// outDest returns a destination for an OUT param of the given SQL Server
+// type, holding v for INOUT params. The destination's Go type decides the
+// type the param is declared with.
+func outDest(typ string, v any) (any, error) {
+	base := strings.ToLower(strings.TrimSpace(strings.SplitN(typ, "(", 2)[0]))
+	switch base {
+	case "bigint", "int", "smallint", "tinyint":
+		d := &sql.NullInt64{}
+		return d, d.Scan(v)
+	case "bit":
+		d := &sql.NullBool{}
+		return d, d.Scan(v)
+	case "float", "real":
+		d := &sql.NullFloat64{}
+		return d, d.Scan(v)
+	case "decimal", "numeric", "money", "smallmoney":
+		// exact numerics are declared as strings, so their OUT values are
+		// returned without the precision a float64 would lose
+		d := &sql.NullString{}
+		if v == nil {
+			return d, nil
+		}
+		dv, err := decimal.NewFromString(strings.TrimSpace(fmt.Sprint(v)))
+		if f, ok := v.(float64); ok {
+			dv, err = decimal.NewFromFloat(f), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %v: %w", base, v, err)
+		}
+		// the param is declared with the length of its value, so the value
+		// is padded to fit any decimal(38) result
+		return d, d.Scan(fmt.Sprintf("%*s", maxDecimalLen, dv.String()))
+	case "binary", "varbinary", "image":
+		d := &[]byte{}
+		if v != nil {
+			*d = []byte(fmt.Sprint(v))
+		}
+		return d, nil
+	}
+	d := &sql.NullString{}
+	if v == nil {
+		return d, nil
+	}
+	if f, ok := v.(float64); ok {
+		return d, d.Scan(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return d, d.Scan(v)
+}
+
+// outValue returns the value an OUT param destination holds.
+func outValue(dest any) any {
+	if b, ok := dest.(*[]byte); ok {
+		return *b
+	}
+	v, _ := dest.(driver.Valuer).Value()
+	return v
+}
+
+// Call calls the stored procedure named by the statement as an RPC, and
+// returns every result set, the OUT params and the procedure's return
+// status as the return_status OUT value.
+func (d *MSSql) Call(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "mssql",
+		"fn":  "Call",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debug("Calling procedure: ", r.Statement)
+	var args []any
+	outs := map[string]any{}
+	n := 0
+	for _, p := range r.ProcParams {
+		var v any
+		if p.In() {
+			v = r.Params[n]
+			n++
+		}
+		if !p.Out() {
+			args = append(args, sql.Named(p.Name, v))
+			continue
+		}
+		dest, err := outDest(p.Type, v)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", p.Name, err)
+			l.Error(err)
+			return &schema.Response{
+				Results: nil,
+				Error:   err,
+			}
+		}
+		outs[p.Name] = dest
+		args = append(args, sql.Named(p.Name, sql.Out{Dest: dest}))
+	}
+	var rs gomssql.ReturnStatus
+	args = append(args, &rs)
+	err := utils.WithConn(d.callClient, r.Options.Transaction, func(q utils.Querier) error {
+		rows, err := q.QueryContext(context.Background(), r.Statement, args...)
+		if err != nil {
+			return err
+		}
+		sets, err := schema.SQLRowsToResultSets(rows, utils.RowsToMapSlice)
+		// OUT params are only set once the rows are closed
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		res.SetResultSets(sets)
+		return nil
+	})
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.Out = map[string]any{"return_status": int64(rs)}
+	for name, dest := range outs {
+		res.Out[name] = outValue(dest)
+	}
+	return res
+}
+
+// BulkInsert copies the request's rows into the table named by the
+// statement with the bulk copy protocol, in a single transaction.
+// Constraints are checked and NULL values are kept.
+func (d *MSSql) BulkInsert(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "mssql",
+		"fn":  "BulkInsert",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debugf("Copying %d rows into %s", len(r.Rows), r.Statement)
+	copyIn := gomssql.CopyIn(r.Statement, gomssql.BulkOptions{CheckConstraints: true, KeepNulls: true}, r.Columns...)
+	var affected int64
+	err := utils.WithConn(d.Client, true, func(q utils.Querier) error {
+		stmt, err := q.PrepareContext(context.Background(), copyIn)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range r.Rows {
+			if _, err := stmt.Exec(row...); err != nil {
+				return err
+			}
+		}
+		result, err := stmt.Exec()
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		return err
+	})
 	if err != nil {
 		l.Error(err)
 		return &schema.Response{
@@ -117,6 +389,6 @@ func (d *MSSql) Exec(r *schema.Request) *schema.Response {
 			Error:   err,
 		}
 	}
-	res.Results = m
+	res.Results = []map[string]any{{"rows_affected": affected}}
 	return res
 }
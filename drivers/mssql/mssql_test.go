@@ -0,0 +1,90 @@
+package mssql
+
+import (
+	"os"
+	"testing"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+// TestIntegrationCall runs against the SQL Server in MSSQL_TEST_HOST, and is
+// skipped if it is not set. MSSQL_TEST_PORT, MSSQL_TEST_USER,
+// MSSQL_TEST_PASS and MSSQL_TEST_DB default to 1433, sa, an empty password
+// and tempdb.
+func TestIntegrationCall(t *testing.T) {
+	host := os.Getenv("MSSQL_TEST_HOST")
+	if host == "" {
+		t.Skip("MSSQL_TEST_HOST is not set")
+	}
+	env := func(k, def string) string {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+		return def
+	}
+	d := &MSSql{}
+	err := d.Connect(map[string]any{
+		"host": host,
+		"port": env("MSSQL_TEST_PORT", "1433"),
+		"user": env("MSSQL_TEST_USER", "sa"),
+		"pass": env("MSSQL_TEST_PASS", ""),
+		"db":   env("MSSQL_TEST_DB", "tempdb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+	res := d.Exec(&schema.Request{Statement: `CREATE OR ALTER PROCEDURE dbo.sigc_test_call
+	@id int,
+	@total decimal(38,10) OUTPUT,
+	@label nvarchar(50) OUTPUT
+AS
+BEGIN
+	SELECT @id AS id;
+	SET @total = @total * 2;
+	SET @label = N'id ' + CAST(@id AS nvarchar(10));
+	RETURN 7;
+END`})
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	defer d.Exec(&schema.Request{Statement: "DROP PROCEDURE dbo.sigc_test_call"})
+	procParams := []schema.ProcParam{
+		{Name: "id", Direction: schema.ProcParamIn},
+		{Name: "total", Direction: schema.ProcParamInOut, Type: "decimal(38,10)"},
+		{Name: "label", Direction: schema.ProcParamOut, Type: "nvarchar(50)"},
+	}
+	tests := []struct {
+		name        string
+		transaction bool
+	}{
+		{"autocommit", false},
+		{"transaction", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := d.Call(&schema.Request{
+				Statement:  "dbo.sigc_test_call",
+				Params:     []any{float64(42), "1234567890123456789012345678.0123456789"},
+				ProcParams: procParams,
+				Options:    schema.QueryOptions{Transaction: tt.transaction},
+			})
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			if len(res.Results) != 1 || res.Results[0]["id"] != int64(42) {
+				t.Errorf("results = %v", res.Results)
+			}
+			want := map[string]any{
+				"return_status": int64(7),
+				"total":         "2469135780246913578024691356.0246913578",
+				"label":         "id 42",
+			}
+			for k, w := range want {
+				if got := res.Out[k]; got != w {
+					t.Errorf("%s = %#v, want %#v", k, got, w)
+				}
+			}
+		})
+	}
+}
@@ -1,22 +1,61 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	gomysql "github.com/go-sql-driver/mysql"
 	"github.com/robertlestak/sigc/internal/utils"
 	"github.com/robertlestak/sigc/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
 
+// Params are the connection params accepted by the mysql driver.
+var Params = []schema.ConnectionParam{
+	{Name: "host", Type: schema.ParamString, Required: true, Description: "The host to connect to."},
+	{Name: "port", Type: schema.ParamInt, Required: true, Description: "The port to connect to."},
+	{Name: "user", Type: schema.ParamString, Required: true, Description: "The username to use when connecting to MySQL."},
+	{Name: "pass", Type: schema.ParamString, Required: true, Secret: true, Description: "The password to use when connecting to MySQL."},
+	{Name: "db", Type: schema.ParamString, Required: true, Description: "The database to use when connecting to MySQL."},
+	{Name: "tls", Type: schema.ParamString, Description: "The TLS mode: `false`, `true`, `skip-verify` or `preferred`. Defaults to `true` if `ssl_ca`, `ssl_cert` or `ssl_key` are set, otherwise `false`."},
+	{Name: "ssl_ca", Type: schema.ParamString, Description: "The CA certificate used to verify the server, as a file path or inline PEM."},
+	{Name: "ssl_cert", Type: schema.ParamString, Description: "The client certificate, as a file path or inline PEM."},
+	{Name: "ssl_key", Type: schema.ParamString, Secret: true, Description: "The client certificate key, as a file path or inline PEM."},
+	{Name: "parse_time", Type: schema.ParamBool, Default: false, Description: "Return `DATE` and `DATETIME` values as timestamps instead of strings."},
+	{Name: "charset", Type: schema.ParamString, Description: "The connection character set, for example `utf8mb4`."},
+	{Name: "collation", Type: schema.ParamString, Description: "The connection collation, for example `utf8mb4_unicode_ci`."},
+	{Name: "timeout", Type: schema.ParamDuration, Default: "10s", Description: "The connect timeout, as a duration such as `10s` or a number of seconds."},
+	{Name: "read_timeout", Type: schema.ParamDuration, Description: "The I/O read timeout, as a duration or a number of seconds."},
+	{Name: "write_timeout", Type: schema.ParamDuration, Description: "The I/O write timeout, as a duration or a number of seconds."},
+}
+
+func init() {
+	schema.RegisterDriverParams("mysql", Params)
+}
+
 type Mysql struct {
-	Client *sql.DB
-	Host   string
-	Port   string
-	User   string
-	Pass   string
-	Db     string
+	Client       *sql.DB
+	Host         string
+	Port         string
+	User         string
+	Pass         string
+	Db           string
+	TLS          string
+	SSLCA        string
+	SSLCert      string
+	SSLKey       string
+	ParseTime    bool
+	Charset      string
+	Collation    string
+	Timeout      time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
 }
 
 func (d *Mysql) parseParams(params map[string]any) error {
@@ -25,27 +64,70 @@ func (d *Mysql) parseParams(params map[string]any) error {
 		"fn":  "parseParams",
 	})
 	l.Debug("start")
-	if params["host"] == nil {
-		return fmt.Errorf("host is required")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
 	}
-	d.Host = params["host"].(string)
-	if params["port"] == nil {
-		return fmt.Errorf("port is required")
+	d.Host = p.String("host")
+	if d.Port, err = p.Port("port"); err != nil {
+		return err
 	}
-	d.Port = params["port"].(string)
-	if params["user"] == nil {
-		return fmt.Errorf("user is required")
+	d.User = p.String("user")
+	d.Pass = p.String("pass")
+	d.Db = p.String("db")
+	d.TLS = p.String("tls")
+	switch d.TLS {
+	case "", "false", "true", "skip-verify", "preferred":
+	default:
+		return fmt.Errorf("tls must be one of false, true, skip-verify or preferred")
 	}
-	d.User = params["user"].(string)
-	if params["pass"] == nil {
-		return fmt.Errorf("pass is required")
+	d.SSLCA = p.String("ssl_ca")
+	d.SSLCert = p.String("ssl_cert")
+	d.SSLKey = p.String("ssl_key")
+	d.ParseTime = p.Bool("parse_time")
+	d.Charset = p.String("charset")
+	d.Collation = p.String("collation")
+	d.Timeout = p.Duration("timeout")
+	d.ReadTimeout = p.Duration("read_timeout")
+	d.WriteTimeout = p.Duration("write_timeout")
+	return nil
+}
+
+func (d *Mysql) config() (*gomysql.Config, error) {
+	cfg := gomysql.NewConfig()
+	cfg.User = d.User
+	cfg.Passwd = d.Pass
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(d.Host, d.Port)
+	cfg.DBName = d.Db
+	cfg.ParseTime = d.ParseTime
+	cfg.Timeout = 10 * time.Second
+	if d.Timeout > 0 {
+		cfg.Timeout = d.Timeout
 	}
-	d.Pass = params["pass"].(string)
-	if params["db"] == nil {
-		return fmt.Errorf("db is required")
+	cfg.ReadTimeout = d.ReadTimeout
+	cfg.WriteTimeout = d.WriteTimeout
+	if d.Collation != "" {
+		cfg.Collation = d.Collation
 	}
-	d.Db = params["db"].(string)
-	return nil
+	if d.Charset != "" {
+		cfg.Params = map[string]string{"charset": d.Charset}
+	}
+	cfg.TLSConfig = d.TLS
+	if d.SSLCA == "" && d.SSLCert == "" && d.SSLKey == "" {
+		return cfg, nil
+	}
+	if d.TLS == "false" {
+		return nil, fmt.Errorf("ssl_ca, ssl_cert and ssl_key require tls")
+	}
+	tc, err := utils.TLSConfig(d.SSLCA, d.SSLCert, d.SSLKey, d.TLS == "skip-verify")
+	if err != nil {
+		return nil, err
+	}
+	tc.ServerName = d.Host
+	cfg.TLS = tc
+	cfg.AllowFallbackToPlaintext = d.TLS == "preferred"
+	return cfg, nil
 }
 
 func (d *Mysql) Connect(params map[string]any) error {
@@ -57,17 +139,22 @@ func (d *Mysql) Connect(params map[string]any) error {
 	if err := d.parseParams(params); err != nil {
 		return err
 	}
-	var err error
-	connStr := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", d.User, d.Pass, d.Host, d.Port, d.Db)
-	l.Debug("Connecting to mysql: ", connStr)
-	d.Client, err = sql.Open("mysql", connStr)
+	cfg, err := d.config()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	connector, err := gomysql.NewConnector(cfg)
 	if err != nil {
 		l.Error(err)
 		return err
 	}
+	l.Debugf("Connecting to mysql: %s/%s", cfg.Addr, cfg.DBName)
+	d.Client = sql.OpenDB(connector)
 	err = d.Client.Ping()
 	if err != nil {
 		l.Error(err)
+		d.Client.Close()
 		return err
 	}
 	l.Debug("Connected")
@@ -89,6 +176,52 @@ func (d *Mysql) Disconnect() error {
 	return nil
 }
 
+// convertValue converts the raw []byte values the text protocol returns
+// into a value matching the column's type. Binary columns are left as
+// []byte.
+func convertValue(dbType string, v any) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	switch dbType {
+	case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return b
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if i, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return i
+		}
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		if i, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return i
+		}
+	case "FLOAT", "DOUBLE":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	}
+	return string(b)
+}
+
+// rowsToMapSlice maps rows into result rows, converting each value to its
+// column's type.
+func rowsToMapSlice(rows *sql.Rows) ([]map[string]any, error) {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	m, err := utils.RowsToMapSlice(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range m {
+		for _, ct := range cts {
+			row[ct.Name()] = convertValue(strings.ToUpper(ct.DatabaseTypeName()), row[ct.Name()])
+		}
+	}
+	return m, nil
+}
+
 func (d *Mysql) Exec(r *schema.Request) *schema.Response {
 	l := log.WithFields(log.Fields{
 		"app": "mysql",
@@ -98,7 +231,15 @@ func (d *Mysql) Exec(r *schema.Request) *schema.Response {
 	var err error
 	res := &schema.Response{}
 	l.Debug("Executing statement: ", r.Statement)
-	resp, err := d.Client.Query(r.Statement, r.Params...)
+	stmt, params, err := utils.ExpandArrays(r.Statement, r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	sets, err := schema.QueryResultSets(d.Client, r.Options.Transaction, stmt, params, rowsToMapSlice)
 	if err != nil {
 		l.Error(err)
 		return &schema.Response{
@@ -106,8 +247,169 @@ func (d *Mysql) Exec(r *schema.Request) *schema.Response {
 			Error:   err,
 		}
 	}
-	defer resp.Close()
-	m, err := utils.RowsToMapSlice(resp)
+	res.SetResultSets(sets)
+	return res
+}
+
+// Prepare prepares the statement without executing it and returns the
+// number of its params.
+func (d *Mysql) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "mysql",
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	n, err := utils.NumInput(d.Client, statement)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	return &schema.Probe{ParamCount: n}, nil
+}
+
+// Retryable reports whether err is a deadlock (1213), after which the
+// statement can be run again.
+func (d *Mysql) Retryable(err error) bool {
+	var myErr *gomysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+	return myErr.Number == 1213
+}
+
+// Call calls the stored procedure named by the statement and returns every
+// result set and the OUT params. OUT and INOUT params are passed through
+// session variables on a single connection.
+func (d *Mysql) Call(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "mysql",
+		"fn":  "Call",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debug("Calling procedure: ", r.Statement)
+	var callArgs, sets, outs []string
+	var args, setArgs []any
+	n := 0
+	for i, p := range r.ProcParams {
+		var v any
+		if p.In() {
+			v = r.Params[n]
+			n++
+		}
+		if !p.Out() {
+			callArgs = append(callArgs, "?")
+			args = append(args, v)
+			continue
+		}
+		sv := fmt.Sprintf("@sigc_out_%d", i)
+		callArgs = append(callArgs, sv)
+		sets = append(sets, sv+" = ?")
+		setArgs = append(setArgs, v)
+		outs = append(outs, fmt.Sprintf("%s AS `%s`", sv, p.Name))
+	}
+	ctx := context.Background()
+	err := utils.WithConn(d.Client, r.Options.Transaction, func(q utils.Querier) error {
+		if len(sets) > 0 {
+			if _, err := q.ExecContext(ctx, "SET "+strings.Join(sets, ", "), setArgs...); err != nil {
+				return err
+			}
+		}
+		rows, err := q.QueryContext(ctx, "CALL "+r.Statement+"("+strings.Join(callArgs, ", ")+")", args...)
+		if err != nil {
+			return err
+		}
+		sets, err := schema.SQLRowsToResultSets(rows, rowsToMapSlice)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		res.SetResultSets(sets)
+		if len(outs) == 0 {
+			return nil
+		}
+		orows, err := q.QueryContext(ctx, "SELECT "+strings.Join(outs, ", "))
+		if err != nil {
+			return err
+		}
+		defer orows.Close()
+		m, err := rowsToMapSlice(orows)
+		if err != nil {
+			return err
+		}
+		if len(m) > 0 {
+			res.Out = m[0]
+		}
+		return nil
+	})
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	return res
+}
+
+// maxPlaceholders is the most placeholders MySQL accepts in a prepared
+// statement.
+const maxPlaceholders = 65535
+
+// quoteIdent quotes an optionally schema qualified identifier.
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + p + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+// BulkInsert inserts the request's rows into the table named by the
+// statement with multi-row INSERT statements, in a single transaction.
+func (d *Mysql) BulkInsert(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "mysql",
+		"fn":  "BulkInsert",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debugf("Inserting %d rows into %s", len(r.Rows), r.Statement)
+	cols := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		cols[i] = quoteIdent(c)
+	}
+	prefix := "INSERT INTO " + quoteIdent(r.Statement) + " (" + strings.Join(cols, ", ") + ") VALUES "
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+	batch := maxPlaceholders / len(cols)
+	if batch > 1000 {
+		batch = 1000
+	}
+	var affected int64
+	err := utils.WithConn(d.Client, true, func(q utils.Querier) error {
+		for start := 0; start < len(r.Rows); start += batch {
+			end := start + batch
+			if end > len(r.Rows) {
+				end = len(r.Rows)
+			}
+			tuples := make([]string, 0, end-start)
+			args := make([]any, 0, (end-start)*len(cols))
+			for _, row := range r.Rows[start:end] {
+				tuples = append(tuples, tuple)
+				args = append(args, row...)
+			}
+			result, err := q.ExecContext(context.Background(), prefix+strings.Join(tuples, ", "), args...)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	})
 	if err != nil {
 		l.Error(err)
 		return &schema.Response{
@@ -115,6 +417,6 @@ func (d *Mysql) Exec(r *schema.Request) *schema.Response {
 			Error:   err,
 		}
 	}
-	res.Results = m
+	res.Results = []map[string]any{{"rows_affected": affected}}
 	return res
 }
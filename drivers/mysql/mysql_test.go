@@ -0,0 +1,241 @@
+package mysql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+// testCA returns a self signed CA certificate as inline PEM.
+func testCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func baseParams() map[string]any {
+	return map[string]any{
+		"host": "db.internal",
+		"port": float64(3306),
+		"user": "app",
+		"pass": "secret",
+		"db":   "orders",
+	}
+}
+
+func TestConfig(t *testing.T) {
+	ca := testCA(t)
+	tests := []struct {
+		name      string
+		params    map[string]any
+		wantErr   bool
+		wantTLS   bool
+		wantDSN   []string
+		wantPlain bool
+	}{
+		{
+			name:    "plain",
+			params:  map[string]any{},
+			wantDSN: []string{"app:secret@tcp(db.internal:3306)/orders", "timeout=10s"},
+		},
+		{
+			name: "options",
+			params: map[string]any{
+				"parse_time":    true,
+				"charset":       "utf8mb4",
+				"collation":     "utf8mb4_unicode_ci",
+				"timeout":       "3s",
+				"read_timeout":  float64(30),
+				"write_timeout": "1m",
+			},
+			wantDSN: []string{"parseTime=true", "charset=utf8mb4", "collation=utf8mb4_unicode_ci", "timeout=3s", "readTimeout=30s", "writeTimeout=1m0s"},
+		},
+		{
+			name:    "tls mode",
+			params:  map[string]any{"tls": "skip-verify"},
+			wantDSN: []string{"tls=skip-verify"},
+		},
+		{
+			name:    "inline ca",
+			params:  map[string]any{"ssl_ca": ca},
+			wantTLS: true,
+		},
+		{
+			name:      "inline ca preferred",
+			params:    map[string]any{"ssl_ca": ca, "tls": "preferred"},
+			wantTLS:   true,
+			wantPlain: true,
+		},
+		{
+			name:    "ca without tls",
+			params:  map[string]any{"ssl_ca": ca, "tls": "false"},
+			wantErr: true,
+		},
+		{
+			name:    "cert without key",
+			params:  map[string]any{"ssl_cert": ca},
+			wantErr: true,
+		},
+		{
+			name:    "invalid tls mode",
+			params:  map[string]any{"tls": "required"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := baseParams()
+			for k, v := range tt.params {
+				params[k] = v
+			}
+			d := &Mysql{}
+			err := d.parseParams(params)
+			if err == nil {
+				_, err = d.config()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			c, _ := d.config()
+			if (c.TLS != nil) != tt.wantTLS {
+				t.Errorf("TLS set = %v, want %v", c.TLS != nil, tt.wantTLS)
+			}
+			if c.TLS != nil && (c.TLS.ServerName != "db.internal" || c.TLS.RootCAs == nil) {
+				t.Errorf("TLS = %+v, want server name and root CAs", c.TLS)
+			}
+			if c.AllowFallbackToPlaintext != tt.wantPlain {
+				t.Errorf("AllowFallbackToPlaintext = %v, want %v", c.AllowFallbackToPlaintext, tt.wantPlain)
+			}
+			dsn := c.FormatDSN()
+			for _, w := range tt.wantDSN {
+				if !strings.Contains(dsn, w) {
+					t.Errorf("DSN %q does not contain %q", dsn, w)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		dbType string
+		v      any
+		want   any
+	}{
+		{"UNSIGNED BIGINT", []byte("18446744073709551615"), uint64(18446744073709551615)},
+		{"UNSIGNED INT", []byte("4294967295"), uint64(4294967295)},
+		{"BIGINT", []byte("-9223372036854775808"), int64(-9223372036854775808)},
+		{"DECIMAL", []byte("12345678901234567890.1234"), "12345678901234567890.1234"},
+		{"DATETIME", []byte("2023-01-02 03:04:05"), "2023-01-02 03:04:05"},
+		{"DOUBLE", []byte("1.5"), 1.5},
+		{"VARCHAR", []byte("abc"), "abc"},
+		{"INT", int64(7), int64(7)},
+		{"INT", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			if got := convertValue(tt.dbType, tt.v); got != tt.want {
+				t.Errorf("convertValue(%s, %v) = %#v, want %#v", tt.dbType, tt.v, got, tt.want)
+			}
+		})
+	}
+	b := convertValue("BLOB", []byte{0, 1})
+	if v, ok := b.([]byte); !ok || len(v) != 2 {
+		t.Errorf("convertValue(BLOB) = %#v, want []byte", b)
+	}
+}
+
+// TestIntegration runs against the MySQL server in MYSQL_TEST_HOST, and is
+// skipped if it is not set. MYSQL_TEST_PORT, MYSQL_TEST_USER,
+// MYSQL_TEST_PASS and MYSQL_TEST_DB default to 3306, root, an empty
+// password and mysql.
+func TestIntegration(t *testing.T) {
+	host := os.Getenv("MYSQL_TEST_HOST")
+	if host == "" {
+		t.Skip("MYSQL_TEST_HOST is not set")
+	}
+	env := func(k, def string) string {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+		return def
+	}
+	d := &Mysql{}
+	err := d.Connect(map[string]any{
+		"host": host,
+		"port": env("MYSQL_TEST_PORT", "3306"),
+		"user": env("MYSQL_TEST_USER", "root"),
+		"pass": env("MYSQL_TEST_PASS", ""),
+		"db":   env("MYSQL_TEST_DB", "mysql"),
+		"tls":  env("MYSQL_TEST_TLS", "false"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+	want := map[string]any{
+		"u":  uint64(18446744073709551615),
+		"d":  "12345678901234.5678",
+		"dt": "2023-01-02 03:04:05",
+	}
+	tests := []struct {
+		name      string
+		statement string
+		params    []any
+	}{
+		{
+			name:      "text protocol",
+			statement: "SELECT CAST(18446744073709551615 AS UNSIGNED) AS u, CAST('12345678901234.5678' AS DECIMAL(20,4)) AS d, CAST('2023-01-02 03:04:05' AS DATETIME) AS dt",
+		},
+		{
+			name:      "binary protocol",
+			statement: "SELECT CAST(? AS UNSIGNED) AS u, CAST(? AS DECIMAL(20,4)) AS d, CAST(? AS DATETIME) AS dt",
+			params:    []any{"18446744073709551615", "12345678901234.5678", "2023-01-02 03:04:05"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := d.Exec(&schema.Request{Statement: tt.statement, Params: tt.params})
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			if len(res.Results) != 1 {
+				t.Fatalf("got %d rows, want 1", len(res.Results))
+			}
+			for k, w := range want {
+				if got := res.Results[0][k]; got != w {
+					t.Errorf("%s = %#v, want %#v", k, got, w)
+				}
+			}
+		})
+	}
+}
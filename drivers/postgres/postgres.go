@@ -1,148 +1,75 @@
 package postgres
 
 import (
-	"database/sql"
 	"fmt"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/robertlestak/sigc/internal/pgwire"
 	"github.com/robertlestak/sigc/internal/utils"
 	"github.com/robertlestak/sigc/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
 
-type Postgres struct {
-	Client      *sql.DB
-	Host        string
-	Port        string
-	User        string
-	Pass        string
-	Db          string
-	SslMode     string
-	SSLRootCert *string
-	SSLCert     *string
-	SSLKey      *string
+// Params are the connection params accepted by the postgres driver.
+var Params = []schema.ConnectionParam{
+	{Name: "host", Type: schema.ParamString, Required: true, Description: "The host to connect to."},
+	{Name: "port", Type: schema.ParamInt, Required: true, Description: "The port to connect to."},
+	{Name: "user", Type: schema.ParamString, Required: true, Description: "The username to use when connecting to Postgres."},
+	{Name: "pass", Type: schema.ParamString, Required: true, Secret: true, Description: "The password to use when connecting to Postgres."},
+	{Name: "db", Type: schema.ParamString, Required: true, Description: "The database to use when connecting to Postgres."},
+	{Name: "sslmode", Type: schema.ParamString, Required: true, Description: "The SSL mode to use when connecting to Postgres: `disable`, `require`, `verify-ca` or `verify-full`."},
+	{Name: "sslrootcert", Type: schema.ParamString, Description: "The SSL root certificate to use when connecting to Postgres, as a file path or inline PEM."},
+	{Name: "sslcert", Type: schema.ParamString, Description: "The SSL certificate to use when connecting to Postgres, as a file path or inline PEM."},
+	{Name: "sslkey", Type: schema.ParamString, Secret: true, Description: "The SSL key to use when connecting to Postgres, as a file path or inline PEM."},
 }
 
-func (d *Postgres) parseParams(params map[string]any) error {
-	l := log.WithFields(log.Fields{
-		"app": "postgres",
-		"fn":  "parseParams",
-	})
-	l.Debug("start")
-	if params["host"] == nil {
-		return fmt.Errorf("host is required")
-	}
-	d.Host = params["host"].(string)
-	if params["port"] == nil {
-		return fmt.Errorf("port is required")
-	}
-	d.Port = params["port"].(string)
-	if params["user"] == nil {
-		return fmt.Errorf("user is required")
-	}
-	d.User = params["user"].(string)
-	if params["pass"] == nil {
-		return fmt.Errorf("pass is required")
-	}
-	d.Pass = params["pass"].(string)
-	if params["db"] == nil {
-		return fmt.Errorf("db is required")
-	}
-	d.Db = params["db"].(string)
-	if params["sslmode"] == nil {
-		return fmt.Errorf("sslmode is required")
-	}
-	d.SslMode = params["sslmode"].(string)
-	if params["sslrootcert"] != nil {
-		d.SSLRootCert = params["sslrootcert"].(*string)
-	}
-	if params["sslcert"] != nil {
-		d.SSLCert = params["sslcert"].(*string)
-	}
-	if params["sslkey"] != nil {
-		d.SSLKey = params["sslkey"].(*string)
-	}
-	return nil
+func init() {
+	schema.RegisterDriverParams("postgres", Params)
 }
 
-func (d *Postgres) Connect(params map[string]any) error {
-	l := log.WithFields(log.Fields{
-		"app": "postgres",
-		"fn":  "Connect",
-	})
-	l.Debug("start")
-	if err := d.parseParams(params); err != nil {
-		return err
-	}
-	var err error
-	var opts string
-	var connStr string = "postgresql://"
-	if d.User != "" && d.Pass != "" {
-		connStr += fmt.Sprintf("%s:%s@%s:%s/%s",
-			d.User, d.Pass, d.Host, d.Port, d.Db)
-	} else if d.User != "" && d.Pass == "" {
-		connStr += fmt.Sprintf("%s@%s:%s/%s",
-			d.User, d.Host, d.Port, d.Db)
-	}
-	connStr += "?sslmode=" + d.SslMode
-	if d.SSLRootCert != nil && *d.SSLRootCert != "" {
-		connStr += "&sslrootcert=" + *d.SSLRootCert
-	}
-	if d.SSLCert != nil && *d.SSLCert != "" {
-		connStr += "&sslcert=" + *d.SSLCert
-	}
-	if d.SSLKey != nil && *d.SSLKey != "" {
-		connStr += "&sslkey=" + *d.SSLKey
-	}
-	connStr += opts
-	d.Client, err = sql.Open("postgres", connStr)
-	if err != nil {
-		l.Error(err)
-		return err
-	}
-	err = d.Client.Ping()
-	if err != nil {
-		l.Error(err)
-		return err
-	}
-	l.Debug("Connected")
-	return nil
+type Postgres struct {
+	pgwire.Conn
 }
 
-func (d *Postgres) Disconnect() error {
+func (d *Postgres) Connect(params map[string]any) error {
 	l := log.WithFields(log.Fields{
 		"app": "postgres",
-		"fn":  "Disconnect",
+		"fn":  "Connect",
 	})
 	l.Debug("start")
-	err := d.Client.Close()
-	if err != nil {
-		l.Error(err)
+	if _, err := d.ParseParams(Params, params); err != nil {
 		return err
 	}
-	l.Debug("Disconnected from psql")
-	return nil
+	return d.Open("postgres", nil)
 }
 
-func (d *Postgres) Exec(r *schema.Request) *schema.Response {
+// Call calls the stored procedure named by the statement and returns its
+// OUT and INOUT params. OUT params are passed as typed NULLs, which requires
+// Postgres 14 or later; earlier versions only support INOUT params.
+func (d *Postgres) Call(r *schema.Request) *schema.Response {
 	l := log.WithFields(log.Fields{
 		"app": "postgres",
-		"fn":  "Exec",
+		"fn":  "Call",
 	})
 	l.Debug("start")
-	var err error
 	res := &schema.Response{}
-	l.Debug("Executing statement: ", r.Statement)
-	resp, err := d.Client.Query(r.Statement, r.Params...)
-	if err != nil {
-		l.Error(err)
-		return &schema.Response{
-			Results: nil,
-			Error:   err,
+	l.Debug("Calling procedure: ", r.Statement)
+	var callArgs []string
+	n := 0
+	for _, p := range r.ProcParams {
+		switch p.Direction {
+		case schema.ProcParamOut:
+			callArgs = append(callArgs, "NULL::"+p.Type)
+		case schema.ProcParamInOut:
+			n++
+			callArgs = append(callArgs, fmt.Sprintf("$%d::%s", n, p.Type))
+		default:
+			n++
+			callArgs = append(callArgs, fmt.Sprintf("$%d", n))
 		}
 	}
-	defer resp.Close()
-	m, err := utils.RowsToMapSlice(resp)
+	stmt := "CALL " + r.Statement + "(" + strings.Join(callArgs, ", ") + ")"
+	m, err := utils.Query(d.Client, r.Options.Transaction, stmt, r.Params, utils.RowsToMapSlice)
 	if err != nil {
 		l.Error(err)
 		return &schema.Response{
@@ -150,6 +77,8 @@ func (d *Postgres) Exec(r *schema.Request) *schema.Response {
 			Error:   err,
 		}
 	}
-	res.Results = m
+	if len(m) > 0 {
+		res.Out = m[0]
+	}
 	return res
 }
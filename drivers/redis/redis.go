@@ -0,0 +1,333 @@
+package redis
+
+import (
+	"crypto/tls"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// placeholderRe matches a positional $N placeholder in a command argument.
+var placeholderRe = regexp.MustCompile(`\$([0-9]+)`)
+
+// Params are the connection params accepted by the redis driver.
+var Params = []schema.ConnectionParam{
+	{Name: "host", Type: schema.ParamString, Required: true, Description: "The host to connect to."},
+	{Name: "port", Type: schema.ParamInt, Required: true, Description: "The port to connect to."},
+	{Name: "pass", Type: schema.ParamString, Secret: true, Description: "The password to use when connecting to Redis."},
+	{Name: "db", Type: schema.ParamInt, Default: 0, Description: "The database number to select."},
+	{Name: "tls", Type: schema.ParamBool, Default: false, Description: "Connect to Redis over TLS."},
+	{Name: "commands", Type: schema.ParamList, Description: "A comma-separated list of commands the statement may run, for example `HGET,HGETALL,XADD`. If this is not set, only read only commands such as `GET` and `HGETALL` are allowed. Use `*` to allow any command."},
+}
+
+func init() {
+	schema.RegisterDriverParams("redis", Params)
+}
+
+type Redis struct {
+	Client   *goredis.Client
+	Host     string
+	Port     string
+	Pass     string
+	Db       int
+	TLS      bool
+	Commands []string
+}
+
+func (d *Redis) parseParams(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "redis",
+		"fn":  "parseParams",
+	})
+	l.Debug("start")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
+	}
+	d.Host = p.String("host")
+	if d.Port, err = p.Port("port"); err != nil {
+		return err
+	}
+	d.Pass = p.String("pass")
+	d.Db = p.Int("db")
+	d.TLS = p.Bool("tls")
+	d.Commands = p.List("commands")
+	return nil
+}
+
+func (d *Redis) Connect(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "redis",
+		"fn":  "Connect",
+	})
+	l.Debug("start")
+	if err := d.parseParams(params); err != nil {
+		return err
+	}
+	opts := &goredis.Options{
+		Addr:        fmt.Sprintf("%s:%s", d.Host, d.Port),
+		Password:    d.Pass,
+		DB:          d.Db,
+		DialTimeout: 10 * time.Second,
+		ReadTimeout: 30 * time.Second,
+	}
+	if d.TLS {
+		opts.TLSConfig = &tls.Config{ServerName: d.Host}
+	}
+	d.Client = goredis.NewClient(opts)
+	if err := d.Client.Ping().Err(); err != nil {
+		l.Error(err)
+		d.Client.Close()
+		return err
+	}
+	l.Debug("Connected")
+	return nil
+}
+
+func (d *Redis) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": "redis",
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	err := d.Client.Close()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debug("Disconnected")
+	return nil
+}
+
+// ParseCommand splits a command template such as "HGET user:$1 email" into
+// its arguments and substitutes the positional $N placeholders with params.
+// Arguments are separated by whitespace and may be double or single quoted.
+// Params are substituted within an argument, so a param can never add or
+// remove arguments.
+func ParseCommand(statement string, params []any) ([]string, error) {
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("statement must contain a command")
+	}
+	for i, t := range tokens {
+		var serr error
+		tokens[i] = placeholderRe.ReplaceAllStringFunc(t, func(ph string) string {
+			n, _ := strconv.Atoi(ph[1:])
+			if n < 1 || n > len(params) {
+				serr = fmt.Errorf("placeholder %s has no matching param", ph)
+				return ph
+			}
+			return paramString(params[n-1])
+		})
+		if serr != nil {
+			return nil, serr
+		}
+	}
+	return tokens, nil
+}
+
+func paramString(p any) string {
+	switch v := p.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(p)
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	var quote rune
+	inToken := false
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in statement")
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+func (d *Redis) allowed(cmd string) bool {
+	if len(d.Commands) == 0 {
+		return schema.RedisReadCommands[strings.ToUpper(cmd)]
+	}
+	for _, c := range d.Commands {
+		if c == "*" || strings.EqualFold(c, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyToMapSlice maps a redis reply into result rows. Scalar replies
+// become a single {"value": v} row, hash replies a single field map, stream
+// replies one row per entry and any other array one {"value": v} row per
+// element.
+func replyToMapSlice(cmd string, reply any) []map[string]any {
+	arr, ok := reply.([]any)
+	if !ok {
+		return []map[string]any{{"value": replyValue(reply)}}
+	}
+	switch cmd {
+	case "HGETALL", "CONFIG":
+		return []map[string]any{pairsToMap(arr)}
+	case "XRANGE", "XREVRANGE", "XCLAIM":
+		return streamEntries(arr, nil)
+	case "XREAD", "XREADGROUP":
+		var sm []map[string]any
+		for _, s := range arr {
+			sa, ok := s.([]any)
+			if !ok || len(sa) != 2 {
+				continue
+			}
+			entries, _ := sa[1].([]any)
+			sm = append(sm, streamEntries(entries, sa[0])...)
+		}
+		return sm
+	}
+	sm := make([]map[string]any, len(arr))
+	for i, e := range arr {
+		sm[i] = map[string]any{"value": replyValue(e)}
+	}
+	return sm
+}
+
+func replyValue(v any) any {
+	if arr, ok := v.([]any); ok {
+		out := make([]any, len(arr))
+		for i, e := range arr {
+			out[i] = replyValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func pairsToMap(arr []any) map[string]any {
+	m := make(map[string]any, len(arr)/2)
+	for i := 0; i+1 < len(arr); i += 2 {
+		m[fmt.Sprint(arr[i])] = replyValue(arr[i+1])
+	}
+	return m
+}
+
+func streamEntries(arr []any, stream any) []map[string]any {
+	var sm []map[string]any
+	for _, e := range arr {
+		ea, ok := e.([]any)
+		if !ok || len(ea) != 2 {
+			continue
+		}
+		fields, _ := ea[1].([]any)
+		m := map[string]any{
+			"id":     ea[0],
+			"fields": pairsToMap(fields),
+		}
+		if stream != nil {
+			m["stream"] = stream
+		}
+		sm = append(sm, m)
+	}
+	return sm
+}
+
+func (d *Redis) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "redis",
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	args, err := ParseCommand(r.Statement, r.Params)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	cmd := strings.ToUpper(args[0])
+	if !d.allowed(cmd) {
+		err := fmt.Errorf("command %s is not allowed", cmd)
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	iargs := make([]any, len(args))
+	for i, a := range args {
+		iargs[i] = a
+	}
+	reply, err := d.Client.Do(iargs...).Result()
+	if err == goredis.Nil {
+		return res
+	}
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.Results = replyToMapSlice(cmd, reply)
+	return res
+}
+
+// Prepare parses the command and checks it is allowed without running it,
+// and returns the number of params it takes.
+func (d *Redis) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "redis",
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	n := utils.MaxPlaceholder(statement)
+	args, err := ParseCommand(statement, make([]any, n))
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	if cmd := strings.ToUpper(args[0]); !d.allowed(cmd) {
+		return nil, fmt.Errorf("command %s is not allowed", cmd)
+	}
+	return &schema.Probe{ParamCount: n}, nil
+}
@@ -1,55 +1,39 @@
 package scylla
 
 import (
-	"fmt"
-	"strings"
-	"time"
-
 	"github.com/gocql/gocql"
+	"github.com/robertlestak/sigc/internal/cql"
 	"github.com/robertlestak/sigc/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
 
-type Scylla struct {
-	Client      *gocql.Session
-	Hosts       []string
-	User        string
-	Password    string
-	Consistency string
-	LocalDC     string
-	Keyspace    string
+// Params are the connection params accepted by the scylla driver.
+var Params = []schema.ConnectionParam{
+	{Name: "hosts", Type: schema.ParamList, Required: true, Description: "A comma-separated list of Scylla hosts to connect to."},
+	{Name: "user", Type: schema.ParamString, Required: true, Description: "The username to use when connecting to Scylla."},
+	{Name: "pass", Aliases: []string{"password"}, Type: schema.ParamString, Required: true, Secret: true, Description: "The password to use when connecting to Scylla. `password` is accepted as an alias."},
+	{Name: "keyspace", Type: schema.ParamString, Required: true, Description: "The keyspace to use when connecting to Scylla."},
+	{Name: "consistency", Type: schema.ParamString, Required: true, Description: "The default consistency level, for example `LOCAL_QUORUM`. Signed requests can override it with `options.consistency`."},
+	{Name: "serial_consistency", Type: schema.ParamString, Description: "The default serial consistency for lightweight transactions: `SERIAL` or `LOCAL_SERIAL`. Signed requests can override it with `options.serial_consistency`."},
+	{Name: "page_size", Type: schema.ParamInt, Default: 5000, Description: "The default number of rows fetched per page. Signed requests can override it with `options.page_size`."},
+	{Name: "proto_version", Type: schema.ParamInt, Default: 4, Description: "The native protocol version to use."},
+	{Name: "speculative_attempts", Type: schema.ParamInt, Default: 0, Description: "The number of speculative executions to start for statements signed with `options.idempotent`."},
+	{Name: "speculative_delay", Type: schema.ParamDuration, Default: "100ms", Description: "The delay before each speculative execution is started, as a duration or a number of seconds."},
+	{Name: "tls", Type: schema.ParamBool, Default: false, Description: "Connect to the cluster over TLS. Implied if `ssl_ca`, `ssl_cert` or `ssl_key` are set."},
+	{Name: "tls_skip_verify", Type: schema.ParamBool, Default: false, Description: "Do not verify the server certificates."},
+	{Name: "ssl_ca", Type: schema.ParamString, Description: "The CA certificate used to verify the servers, as a file path or inline PEM."},
+	{Name: "ssl_cert", Type: schema.ParamString, Description: "The client certificate, as a file path or inline PEM."},
+	{Name: "ssl_key", Type: schema.ParamString, Secret: true, Description: "The client certificate key, as a file path or inline PEM."},
+	{Name: "local_dc", Type: schema.ParamString, Description: "The local datacenter to use when connecting to Scylla."},
 }
 
-func (d *Scylla) parseParams(params map[string]any) error {
-	l := log.WithFields(log.Fields{
-		"app": "scylla",
-		"fn":  "parseParams",
-	})
-	l.Debug("start")
-	if params["hosts"] == nil {
-		return fmt.Errorf("hosts is required")
-	}
-	d.Hosts = strings.Split(params["hosts"].(string), ",")
-	if params["user"] == nil {
-		return fmt.Errorf("user is required")
-	}
-	d.User = params["user"].(string)
-	if params["password"] == nil {
-		return fmt.Errorf("password is required")
-	}
-	d.Password = params["password"].(string)
-	if params["consistency"] == nil {
-		return fmt.Errorf("consistency is required")
-	}
-	d.Consistency = params["consistency"].(string)
-	if params["keyspace"] == nil {
-		return fmt.Errorf("keyspace is required")
-	}
-	d.Keyspace = params["keyspace"].(string)
-	if params["local_dc"] != nil {
-		d.LocalDC = params["local_dc"].(string)
-	}
-	return nil
+func init() {
+	schema.RegisterDriverParams("scylla", Params)
+}
+
+type Scylla struct {
+	cql.Conn
+	LocalDC string
 }
 
 func (d *Scylla) Connect(params map[string]any) error {
@@ -58,75 +42,16 @@ func (d *Scylla) Connect(params map[string]any) error {
 		"fn":  "Connect",
 	})
 	l.Debug("start")
-	if err := d.parseParams(params); err != nil {
-		return err
-	}
-	cluster := gocql.NewCluster(d.Hosts...)
-	// parse consistency string
-	consistencyLevel := gocql.ParseConsistency(d.Consistency)
-	cluster.Consistency = consistencyLevel
-	if d.Keyspace != "" {
-		cluster.Keyspace = d.Keyspace
-	}
-	cluster.ProtoVersion = 4
-	cluster.ConnectTimeout = time.Second * 10
-	if d.User != "" || d.Password != "" {
-		cluster.Authenticator = gocql.PasswordAuthenticator{Username: d.User, Password: d.Password}
-	}
-	fallback := gocql.RoundRobinHostPolicy()
-	if d.LocalDC != "" {
-		fallback = gocql.DCAwareRoundRobinPolicy(d.LocalDC)
-	}
-	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(fallback)
-	if d.LocalDC != "" {
-		cluster.Consistency = gocql.LocalQuorum
-	}
-	session, err := cluster.CreateSession()
+	p, err := d.ParseParams(Params, params)
 	if err != nil {
 		return err
 	}
-	d.Client = session
-	return nil
-}
-
-func (d *Scylla) Disconnect() error {
-	l := log.WithFields(log.Fields{
-		"app": "scylla",
-		"fn":  "Disconnect",
-	})
-	l.Debug("start")
-	d.Client.Close()
-	l.Debug("Disconnected")
-	return nil
-}
-
-func (d *Scylla) Exec(r *schema.Request) *schema.Response {
-	l := log.WithFields(log.Fields{
-		"app": "scylla",
-		"fn":  "Exec",
-	})
-	l.Debug("start")
-	var err error
-	res := &schema.Response{}
-	l.Debug("Executing statement: ", r.Statement)
-	qry := d.Client.Query(r.Statement, r.Params...)
-	defer qry.Release()
-	m, err := schema.CqlRowsToMapSlice(qry)
-	if err != nil {
-		if err == gocql.ErrNotFound {
-			return nil
-		}
-		return &schema.Response{
-			Error: err,
-		}
-	}
-	if err != nil {
-		l.Error(err)
-		return &schema.Response{
-			Results: nil,
-			Error:   err,
+	d.LocalDC = p.String("local_dc")
+	return d.Open("scylla", params, func(cluster *gocql.ClusterConfig) {
+		fallback := gocql.RoundRobinHostPolicy()
+		if d.LocalDC != "" {
+			fallback = gocql.DCAwareRoundRobinPolicy(d.LocalDC)
 		}
-	}
-	res.Results = m
-	return res
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(fallback)
+	})
 }
@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultBusyTimeout is the number of milliseconds a statement waits on a
+// locked database before failing with SQLITE_BUSY.
+const defaultBusyTimeout = 5000
+
+// Params are the connection params accepted by the sqlite driver.
+var Params = []schema.ConnectionParam{
+	{Name: "path", Type: schema.ParamString, Required: true, Description: "The path to the SQLite database file. Use `:memory:` for a transient in-memory database. The file must exist, it is not created."},
+	{Name: "read_only", Type: schema.ParamBool, Default: false, Description: "Open the database in read-only mode."},
+	{Name: "busy_timeout", Type: schema.ParamInt, Default: defaultBusyTimeout, Description: "The number of milliseconds to wait on a locked database before failing."},
+}
+
+func init() {
+	schema.RegisterDriverParams("sqlite", Params)
+}
+
+type Sqlite struct {
+	Client      *sql.DB
+	Path        string
+	ReadOnly    bool
+	BusyTimeout int
+}
+
+func (d *Sqlite) parseParams(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "sqlite",
+		"fn":  "parseParams",
+	})
+	l.Debug("start")
+	p, err := schema.ParseParams(Params, params)
+	if err != nil {
+		return err
+	}
+	if d.Path = p.String("path"); d.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	d.ReadOnly = p.Bool("read_only")
+	if d.BusyTimeout = p.Int("busy_timeout"); d.BusyTimeout < 0 {
+		return fmt.Errorf("busy_timeout must be equal or greater than 0")
+	}
+	return nil
+}
+
+func (d *Sqlite) Connect(params map[string]any) error {
+	l := log.WithFields(log.Fields{
+		"app": "sqlite",
+		"fn":  "Connect",
+	})
+	l.Debug("start")
+	if err := d.parseParams(params); err != nil {
+		return err
+	}
+	var err error
+	opts := url.Values{}
+	opts.Set("_busy_timeout", strconv.Itoa(d.BusyTimeout))
+	// mode=rw fails on a missing database file instead of creating it.
+	opts.Set("mode", "rw")
+	if d.ReadOnly {
+		opts.Set("mode", "ro")
+	}
+	u := &url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: d.Path}).EscapedPath(),
+		RawQuery: opts.Encode(),
+	}
+	connStr := u.String()
+	l.Debug("Connecting to sqlite: ", d.Path)
+	d.Client, err = sql.Open("sqlite3", connStr)
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	err = d.Client.Ping()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debug("Connected")
+	return nil
+}
+
+func (d *Sqlite) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": "sqlite",
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	err := d.Client.Close()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debug("Disconnected")
+	return nil
+}
+
+func (d *Sqlite) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "sqlite",
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	var err error
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	stmt, params, err := utils.ExpandArrays(r.Statement, r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	sets, err := schema.QueryResultSets(d.Client, r.Options.Transaction, stmt, params, utils.RowsToMapSlice)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.SetResultSets(sets)
+	return res
+}
+
+// Prepare prepares the statement without executing it and returns the
+// number of its params.
+func (d *Sqlite) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "sqlite",
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	n, err := utils.NumInput(d.Client, statement)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	return &schema.Probe{ParamCount: n}, nil
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// Principal types.
+const (
+	PrincipalAnonymous = "anonymous"
+	PrincipalAPIKey    = "api_key"
+	PrincipalMTLS      = "mtls"
+	PrincipalJWT       = "jwt"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request carries no valid
+	// credentials.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// Principal is an authenticated signer.
+type Principal struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// String returns the principal as type:name.
+func (p *Principal) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.Type + ":" + p.Name
+}
+
+// APIKey is a static API key. Hash is the hex encoded sha256 of the key.
+type APIKey struct {
+	ID        string `json:"id"`
+	Hash      string `json:"hash"`
+	Principal string `json:"principal"`
+}
+
+// MTLSConfig authenticates clients by their TLS certificate. If Principals
+// is set only the certificates it maps, by their hex encoded sha256
+// fingerprint, are accepted. Otherwise the principal is the certificate's
+// subject common name.
+type MTLSConfig struct {
+	Enabled    bool              `json:"enabled"`
+	Principals map[string]string `json:"principals,omitempty"`
+}
+
+// JWTConfig authenticates clients by a bearer token signed by a key of the
+// local JWKS file.
+type JWTConfig struct {
+	JWKSFile       string   `json:"jwks_file"`
+	Issuer         string   `json:"issuer,omitempty"`
+	Audience       string   `json:"audience,omitempty"`
+	PrincipalClaim string   `json:"principal_claim,omitempty"`
+	Algorithms     []string `json:"algorithms,omitempty"`
+}
+
+// Config is the authentication config of the sign server.
+type Config struct {
+	APIKeys []APIKey    `json:"api_keys,omitempty"`
+	MTLS    *MTLSConfig `json:"mtls,omitempty"`
+	JWT     *JWTConfig  `json:"jwt,omitempty"`
+
+	jwks *JWKS
+}
+
+// LoadConfig reads the config from the JSON file at path.
+func LoadConfig(path string) (*Config, error) {
+	l := log.WithFields(log.Fields{
+		"app":  "auth",
+		"fn":   "LoadConfig",
+		"path": path,
+	})
+	l.Debug("start")
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(fd, c); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	for i, k := range c.APIKeys {
+		if k.ID == "" {
+			return fmt.Errorf("api_keys[%d]: id is required", i)
+		}
+		if k.Principal == "" {
+			return fmt.Errorf("api_keys[%d]: principal is required", i)
+		}
+		h, err := hex.DecodeString(k.Hash)
+		if err != nil || len(h) != sha256.Size {
+			return fmt.Errorf("api_keys[%d]: hash must be a hex encoded sha256", i)
+		}
+		c.APIKeys[i].Hash = strings.ToLower(k.Hash)
+	}
+	if c.MTLS != nil && len(c.MTLS.Principals) > 0 {
+		ps := make(map[string]string, len(c.MTLS.Principals))
+		for fp, name := range c.MTLS.Principals {
+			ps[strings.ToLower(strings.ReplaceAll(fp, ":", ""))] = name
+		}
+		c.MTLS.Principals = ps
+	}
+	if c.JWT != nil {
+		if c.JWT.JWKSFile == "" {
+			return errors.New("jwt: jwks_file is required")
+		}
+		if c.JWT.PrincipalClaim == "" {
+			c.JWT.PrincipalClaim = "sub"
+		}
+		jwks, err := LoadJWKS(c.JWT.JWKSFile)
+		if err != nil {
+			return fmt.Errorf("jwt: %w", err)
+		}
+		c.jwks = jwks
+	}
+	if len(c.APIKeys) == 0 && (c.MTLS == nil || !c.MTLS.Enabled) && c.JWT == nil {
+		return errors.New("no authentication method is configured")
+	}
+	return nil
+}
+
+// Authenticate returns the principal of the request. Credentials are tried
+// in order: API key, bearer token and client certificate. A request which
+// presents invalid credentials is rejected even if it also presents valid
+// credentials of a later method.
+func (c *Config) Authenticate(r *http.Request) (*Principal, error) {
+	l := log.WithFields(log.Fields{
+		"app": "auth",
+		"fn":  "Authenticate",
+	})
+	l.Debug("start")
+	if key := r.Header.Get("X-API-Key"); key != "" && len(c.APIKeys) > 0 {
+		return c.authenticateAPIKey(key)
+	}
+	if h := r.Header.Get("Authorization"); c.JWT != nil && strings.HasPrefix(h, "Bearer ") {
+		return c.authenticateJWT(strings.TrimPrefix(h, "Bearer "))
+	}
+	if c.MTLS != nil && c.MTLS.Enabled && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return c.authenticateCert(r.TLS.VerifiedChains[0][0])
+	}
+	return nil, ErrUnauthenticated
+}
+
+func (c *Config) authenticateAPIKey(key string) (*Principal, error) {
+	k, err := c.apiKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Type: PrincipalAPIKey, Name: k.Principal}, nil
+}
+
+// apiKey returns the configured API key matching key.
+func (c *Config) apiKey(key string) (*APIKey, error) {
+	sum := sha256.Sum256([]byte(key))
+	h := []byte(hex.EncodeToString(sum[:]))
+	for i, k := range c.APIKeys {
+		if subtle.ConstantTimeCompare(h, []byte(k.Hash)) == 1 {
+			return &c.APIKeys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid api key", ErrUnauthenticated)
+}
+
+// CertFingerprint returns the hex encoded sha256 fingerprint of cert.
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Caller returns the identity of a client executing a signed request. Unlike
+// Authenticate, every credential the request presents is verified and
+// recorded, and a request without credentials is an anonymous caller. The
+// client certificate is recorded if the TLS handshake verified it, whether
+// or not mtls is enabled. A nil config only identifies callers by their
+// client certificate.
+func (c *Config) Caller(r *http.Request) (*schema.Caller, error) {
+	l := log.WithFields(log.Fields{
+		"app": "auth",
+		"fn":  "Caller",
+	})
+	l.Debug("start")
+	caller := &schema.Caller{}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		caller.CertFingerprint = CertFingerprint(r.TLS.VerifiedChains[0][0])
+	}
+	if c == nil {
+		return caller, nil
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" && len(c.APIKeys) > 0 {
+		k, err := c.apiKey(key)
+		if err != nil {
+			return nil, err
+		}
+		caller.APIKeyID = k.ID
+	}
+	if h := r.Header.Get("Authorization"); c.JWT != nil && strings.HasPrefix(h, "Bearer ") {
+		claims, err := c.verifyJWT(strings.TrimPrefix(h, "Bearer "))
+		if err != nil {
+			return nil, err
+		}
+		caller.Subject, _ = claims["sub"].(string)
+		caller.Audience = audience(claims)
+	}
+	return caller, nil
+}
+
+func (c *Config) authenticateCert(cert *x509.Certificate) (*Principal, error) {
+	fp := CertFingerprint(cert)
+	if len(c.MTLS.Principals) > 0 {
+		name, ok := c.MTLS.Principals[fp]
+		if !ok {
+			return nil, fmt.Errorf("%w: client certificate %s is not allowed", ErrUnauthenticated, fp)
+		}
+		return &Principal{Type: PrincipalMTLS, Name: name}, nil
+	}
+	if cert.Subject.CommonName == "" {
+		return nil, fmt.Errorf("%w: client certificate has no common name", ErrUnauthenticated)
+	}
+	return &Principal{Type: PrincipalMTLS, Name: cert.Subject.CommonName}, nil
+}
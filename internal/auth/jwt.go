@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultAlgorithms are the token algorithms accepted if the config does not
+// set any.
+var defaultAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWK is a public JSON Web Key. Only RSA and EC keys are supported.
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey returns the key as an *rsa.PublicKey or *ecdsa.PublicKey.
+func (k *JWK) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var crv elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			crv = elliptic.P256()
+		case "P-384":
+			crv = elliptic.P384()
+		case "P-521":
+			crv = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: crv, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !crv.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the key: the base64url
+// encoded sha256 of its required members, in lexical order.
+func (k *JWK) Thumbprint() (string, error) {
+	var m map[string]string
+	switch k.Kty {
+	case "RSA":
+		m = map[string]string{"e": k.E, "kty": k.Kty, "n": k.N}
+	case "EC":
+		m = map[string]string{"crv": k.Crv, "kty": k.Kty, "x": k.X, "y": k.Y}
+	default:
+		return "", fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+	// json.Marshal sorts map keys, as the thumbprint requires
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS is a set of public keys, indexed by key ID.
+type JWKS struct {
+	Keys map[string]any
+}
+
+// LoadJWKS reads the JSON Web Key Set at path. Every key must have a kid,
+// and keys which are not for signing are ignored.
+func LoadJWKS(path string) (*JWKS, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(fd, &set); err != nil {
+		return nil, err
+	}
+	s := &JWKS{Keys: map[string]any{}}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kid == "" {
+			return nil, fmt.Errorf("keys[%d]: kid is required", i)
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		s.Keys[k.Kid] = pub
+	}
+	if len(s.Keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return s, nil
+}
+
+// verifyJWT verifies the token's signature, expiry, issuer and audience,
+// and returns its claims.
+func (c *Config) verifyJWT(token string) (jwt.MapClaims, error) {
+	algs := c.JWT.Algorithms
+	if len(algs) == 0 {
+		algs = defaultAlgorithms
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		pub, ok := c.jwks.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return pub, nil
+	}, jwt.WithValidMethods(algs))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if c.JWT.Issuer != "" && !claims.VerifyIssuer(c.JWT.Issuer, true) {
+		return nil, fmt.Errorf("%w: invalid issuer", ErrUnauthenticated)
+	}
+	if c.JWT.Audience != "" && !claims.VerifyAudience(c.JWT.Audience, true) {
+		return nil, fmt.Errorf("%w: invalid audience", ErrUnauthenticated)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrUnauthenticated)
+	}
+	return claims, nil
+}
+
+// authenticateJWT returns the principal named by the token's principal
+// claim.
+func (c *Config) authenticateJWT(token string) (*Principal, error) {
+	claims, err := c.verifyJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := claims[c.JWT.PrincipalClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, c.JWT.PrincipalClaim)
+	}
+	return &Principal{Type: PrincipalJWT, Name: name}, nil
+}
+
+// audience returns the token's aud claim, which is a string or an array of
+// strings.
+func audience(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var out []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
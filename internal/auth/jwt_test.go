@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		JWT: &JWTConfig{Issuer: "https://issuer", Audience: "sigc", PrincipalClaim: "sub", Algorithms: []string{"RS256"}},
+		jwks: &JWKS{Keys: map[string]any{
+			"rsa": &rsaKey.PublicKey,
+			"ec":  &ecKey.PublicKey,
+		}},
+	}
+	claims := func(mod func(jwt.MapClaims)) jwt.MapClaims {
+		m := jwt.MapClaims{
+			"sub": "alice",
+			"iss": "https://issuer",
+			"aud": "sigc",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if mod != nil {
+			mod(m)
+		}
+		return m
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, m jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(method, m)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			token: sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)),
+		},
+		{
+			name:    "hmac with the public key",
+			token:   sign(jwt.SigningMethodHS256, "rsa", pubDER, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "alg none",
+			token:   sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "alg not configured",
+			token:   sign(jwt.SigningMethodES256, "ec", ecKey, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "missing exp",
+			token:   sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(m jwt.MapClaims) { delete(m, "exp") })),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(m jwt.MapClaims) { m["exp"] = time.Now().Add(-time.Hour).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(m jwt.MapClaims) { m["iss"] = "https://other" })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(m jwt.MapClaims) { m["aud"] = []string{"other"} })),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(jwt.SigningMethodRS256, "other", rsaKey, claims(nil)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.verifyJWT(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// ProofType is the typ header of a proof.
+	ProofType = "dpop+jwt"
+	// maxNonceLength is the maximum length of a proof's jti.
+	maxNonceLength = 128
+)
+
+var (
+	// ErrInvalidProof is returned when a proof of possession is missing or
+	// invalid.
+	ErrInvalidProof = errors.New("invalid proof")
+)
+
+// ProofClaims are the claims of a proof of possession of a client key. The
+// proof is a JWT signed by the client key, which is sent in its jwk header.
+type ProofClaims struct {
+	// Nonce is a value the client does not reuse.
+	Nonce string `json:"jti"`
+	// IssuedAt is the time the proof was created, in Unix seconds.
+	IssuedAt int64 `json:"iat"`
+	// KeyID is the key_id of the signed request being executed.
+	KeyID string `json:"key_id"`
+	// ParamsHash is the base64url encoded sha256 of the params sent with
+	// the proof.
+	ParamsHash string `json:"params_hash"`
+}
+
+// Valid is a no-op, the claims are checked by VerifyProof.
+func (c *ProofClaims) Valid() error {
+	return nil
+}
+
+// VerifyProof verifies a proof that the caller holds the client key with
+// the given thumbprint, made for the signed request keyID and the params
+// with paramsHash, within window of now. It returns the proof's claims, of
+// which the caller must check the nonce has not been used.
+func VerifyProof(proof, thumbprint, keyID, paramsHash string, window time.Duration, now time.Time) (*ProofClaims, error) {
+	if proof == "" {
+		return nil, fmt.Errorf("%w: proof is required", ErrInvalidProof)
+	}
+	claims := &ProofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != ProofType {
+			return nil, fmt.Errorf("typ must be %s", ProofType)
+		}
+		b, err := json.Marshal(t.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		k := &JWK{}
+		if err := json.Unmarshal(b, k); err != nil {
+			return nil, fmt.Errorf("jwk is invalid: %w", err)
+		}
+		tp, err := k.Thumbprint()
+		if err != nil {
+			return nil, fmt.Errorf("jwk is invalid: %w", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(tp), []byte(thumbprint)) != 1 {
+			return nil, errors.New("jwk does not match the client key")
+		}
+		return k.PublicKey()
+	}, jwt.WithValidMethods(defaultAlgorithms), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if claims.Nonce == "" || len(claims.Nonce) > maxNonceLength {
+		return nil, fmt.Errorf("%w: jti must be 1 to %d characters", ErrInvalidProof, maxNonceLength)
+	}
+	iat := time.Unix(claims.IssuedAt, 0)
+	if claims.IssuedAt == 0 || iat.Before(now.Add(-window)) || iat.After(now.Add(window)) {
+		return nil, fmt.Errorf("%w: iat must be within %s of now", ErrInvalidProof, window)
+	}
+	if claims.KeyID != keyID {
+		return nil, fmt.Errorf("%w: key_id does not match", ErrInvalidProof)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.ParamsHash), []byte(paramsHash)) != 1 {
+		return nil, fmt.Errorf("%w: params_hash does not match", ErrInvalidProof)
+	}
+	return claims, nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func testJWK(t *testing.T) (*ecdsa.PrivateKey, *JWK) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, &JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	key, jwk := testJWK(t)
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, otherJWK := testJWK(t)
+	now := time.Unix(1700000000, 0)
+	window := 5 * time.Minute
+	claims := func(mod func(*ProofClaims)) *ProofClaims {
+		c := &ProofClaims{Nonce: "n1", IssuedAt: now.Unix(), KeyID: "kid", ParamsHash: "hash"}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	sign := func(key *ecdsa.PrivateKey, jwk *JWK, typ string, c *ProofClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, c)
+		tok.Header["typ"] = typ
+		tok.Header["jwk"] = jwk
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		proof   string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			proof: sign(key, jwk, ProofType, claims(nil)),
+		},
+		{
+			name:    "missing",
+			proof:   "",
+			wantErr: true,
+		},
+		{
+			name:    "thumbprint mismatch",
+			proof:   sign(otherKey, otherJWK, ProofType, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "signed by another key",
+			proof:   sign(otherKey, jwk, ProofType, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "wrong typ",
+			proof:   sign(key, jwk, "JWT", claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:  "iat at the edge of the window",
+			proof: sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.IssuedAt = now.Add(-window).Unix() })),
+		},
+		{
+			name:    "iat before the window",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.IssuedAt = now.Add(-window - time.Second).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:    "iat after the window",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.IssuedAt = now.Add(window + time.Second).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:    "missing iat",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.IssuedAt = 0 })),
+			wantErr: true,
+		},
+		{
+			name:    "missing jti",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.Nonce = "" })),
+			wantErr: true,
+		},
+		{
+			name:    "other key_id",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.KeyID = "other" })),
+			wantErr: true,
+		},
+		{
+			name:    "other params_hash",
+			proof:   sign(key, jwk, ProofType, claims(func(c *ProofClaims) { c.ParamsHash = "other" })),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := VerifyProof(tt.proof, thumbprint, "kid", "hash", window, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("VerifyProof() error = %v, want ErrInvalidProof", err)
+			}
+			if err == nil && c.Nonce != "n1" {
+				t.Errorf("nonce = %q, want n1", c.Nonce)
+			}
+		})
+	}
+}
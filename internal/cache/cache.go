@@ -13,6 +13,16 @@ import (
 var (
 	Client     *redis.Client
 	KeysPrefix string = "keys:"
+	// NoncesPrefix prefixes the nonces of the proofs of possession which
+	// have been used.
+	NoncesPrefix string = "nonces:"
+	// RateLimitsPrefix prefixes the use logs of rate limited keys.
+	RateLimitsPrefix string = "ratelimits:"
+	// FreezesPrefix prefixes the freezes of executions.
+	FreezesPrefix string = "freezes:"
+	// IdempotencyPrefix prefixes the executions of requests with an
+	// idempotency key.
+	IdempotencyPrefix string = "idempotency:"
 )
 
 func Init() error {
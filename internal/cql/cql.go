@@ -0,0 +1,466 @@
+package cql
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/inf.v0"
+)
+
+// Conn is a connection to a Cassandra or Scylla cluster. It implements the
+// parts of the cassandra and scylla drivers which are the same for both.
+type Conn struct {
+	Client              *gocql.Session
+	Hosts               []string
+	User                string
+	Password            string
+	Consistency         gocql.Consistency
+	SerialConsistency   gocql.SerialConsistency
+	PageSize            int
+	ProtoVersion        int
+	SpeculativeAttempts int
+	SpeculativeDelay    time.Duration
+	TLS                 bool
+	TLSSkipVerify       bool
+	SSLCA               string
+	SSLCert             string
+	SSLKey              string
+	Keyspace            string
+
+	driver     string
+	sessionKey string
+}
+
+// ParseParams parses the connection params shared by the CQL drivers
+// against the driver's params, and returns them for the driver to parse
+// its own params.
+func (d *Conn) ParseParams(specs []schema.ConnectionParam, params map[string]any) (schema.ParamValues, error) {
+	p, err := schema.ParseParams(specs, params)
+	if err != nil {
+		return nil, err
+	}
+	if d.Hosts = p.List("hosts"); len(d.Hosts) == 0 {
+		return nil, fmt.Errorf("hosts is required")
+	}
+	d.User = p.String("user")
+	d.Password = p.String("pass")
+	d.Keyspace = p.String("keyspace")
+	c := p.String("consistency")
+	if d.Consistency, err = gocql.ParseConsistencyWrapper(c); err != nil {
+		return nil, fmt.Errorf("consistency %s is not a valid consistency", c)
+	}
+	if d.SerialConsistency, err = parseSerialConsistency(p.String("serial_consistency")); err != nil {
+		return nil, err
+	}
+	if d.PageSize = p.Int("page_size"); d.PageSize < 0 {
+		return nil, fmt.Errorf("page_size must be equal or greater than 0")
+	}
+	if d.ProtoVersion = p.Int("proto_version"); d.ProtoVersion < 1 || d.ProtoVersion > 5 {
+		return nil, fmt.Errorf("proto_version must be between 1 and 5")
+	}
+	if d.SpeculativeAttempts = p.Int("speculative_attempts"); d.SpeculativeAttempts < 0 {
+		return nil, fmt.Errorf("speculative_attempts must be equal or greater than 0")
+	}
+	d.SpeculativeDelay = p.Duration("speculative_delay")
+	d.TLS = p.Bool("tls")
+	d.TLSSkipVerify = p.Bool("tls_skip_verify")
+	d.SSLCA = p.String("ssl_ca")
+	d.SSLCert = p.String("ssl_cert")
+	d.SSLKey = p.String("ssl_key")
+	return p, nil
+}
+
+// parseSerialConsistency parses a serial consistency name. An empty name
+// is parsed as SERIAL.
+func parseSerialConsistency(s string) (gocql.SerialConsistency, error) {
+	sc := gocql.Serial
+	if s == "" {
+		return sc, nil
+	}
+	if err := sc.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return sc, fmt.Errorf("serial_consistency must be SERIAL or LOCAL_SERIAL")
+	}
+	return sc, nil
+}
+
+// Open connects to the cluster of the parsed params, reusing a cached
+// session for the same driver and params if there is one. configure, if
+// set, applies the driver's own settings to the cluster config.
+func (d *Conn) Open(driver string, params map[string]any, configure func(*gocql.ClusterConfig)) error {
+	d.driver = driver
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Open",
+	})
+	l.Debug("start")
+	key, err := sessionKey(driver, params)
+	if err != nil {
+		return err
+	}
+	if s := sessions.acquire(key, time.Now()); s != nil {
+		l.Debug("using cached session")
+		d.Client, d.sessionKey = s.(*gocql.Session), key
+		return nil
+	}
+	cluster := gocql.NewCluster(d.Hosts...)
+	cluster.Consistency = d.Consistency
+	cluster.SerialConsistency = d.SerialConsistency
+	cluster.PageSize = d.PageSize
+	if d.Keyspace != "" {
+		cluster.Keyspace = d.Keyspace
+	}
+	cluster.ProtoVersion = d.ProtoVersion
+	cluster.ConnectTimeout = time.Second * 10
+	if d.User != "" || d.Password != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: d.User, Password: d.Password}
+	}
+	if d.TLS || d.SSLCA != "" || d.SSLCert != "" || d.SSLKey != "" {
+		tc, err := utils.TLSConfig(d.SSLCA, d.SSLCert, d.SSLKey, d.TLSSkipVerify)
+		if err != nil {
+			l.Error(err)
+			return err
+		}
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 tc,
+			EnableHostVerification: !d.TLSSkipVerify,
+		}
+	}
+	if configure != nil {
+		configure(cluster)
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return err
+	}
+	sessions.startSweeper()
+	d.Client, d.sessionKey = sessions.store(key, session, time.Now()).(*gocql.Session), key
+	return nil
+}
+
+// Disconnect releases the session. It is kept open in the session cache
+// for the next request until it has been idle for
+// CQL_SESSION_IDLE_TIMEOUT.
+func (d *Conn) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	if d.sessionKey != "" {
+		sessions.release(d.sessionKey, time.Now())
+	}
+	d.Client, d.sessionKey = nil, ""
+	l.Debug("Disconnected")
+	return nil
+}
+
+func (d *Conn) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	var err error
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	params, err := utils.NativeArrays(r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	qry := d.Client.Query(r.Statement, params...)
+	defer qry.Release()
+	if err := d.applyOptions(qry, r.Options); err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	m, err := schema.CqlRowsToMapSlice(qry)
+	if err == gocql.ErrNotFound {
+		return res
+	}
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.Results = m
+	return res
+}
+
+// applyOptions applies the query options of a signed request to qry.
+func (d *Conn) applyOptions(qry *gocql.Query, o schema.QueryOptions) error {
+	if o.Consistency != "" {
+		c, err := gocql.ParseConsistencyWrapper(o.Consistency)
+		if err != nil {
+			return err
+		}
+		qry.Consistency(c)
+	}
+	if o.SerialConsistency != "" {
+		sc, err := parseSerialConsistency(o.SerialConsistency)
+		if err != nil {
+			return err
+		}
+		qry.SerialConsistency(sc)
+	}
+	if o.PageSize > 0 {
+		qry.PageSize(o.PageSize)
+	}
+	if o.Idempotent {
+		qry.Idempotent(true)
+		if d.SpeculativeAttempts > 0 {
+			qry.SetSpeculativeExecutionPolicy(&gocql.SimpleSpeculativeExecution{
+				NumAttempts:  d.SpeculativeAttempts,
+				TimeoutDelay: d.SpeculativeDelay,
+			})
+		}
+	}
+	return nil
+}
+
+// errProbe stops a query after it has been prepared so it is never
+// executed.
+var errProbe = errors.New("probe")
+
+// Prepare prepares the statement on the cluster without executing it and
+// returns the number and types of its bind markers. Only SELECT, INSERT,
+// UPDATE, DELETE and BATCH statements can be prepared.
+func (d *Conn) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	fields := strings.Fields(statement)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("statement is not a valid CQL statement")
+	}
+	kind := strings.ToUpper(fields[0])
+	if kind == "BEGIN" {
+		kind = strings.ToUpper(strings.TrimRight(fields[len(fields)-1], ";"))
+	}
+	switch kind {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "BATCH":
+	default:
+		l.Debug("statement can not be prepared")
+		return &schema.Probe{ParamCount: -1}, nil
+	}
+	p := &schema.Probe{}
+	qry := d.Client.Bind(statement, func(q *gocql.QueryInfo) ([]any, error) {
+		p.ParamCount = len(q.Args)
+		for _, a := range q.Args {
+			p.ParamTypes = append(p.ParamTypes, a.TypeInfo.Type().String())
+		}
+		return nil, errProbe
+	})
+	defer qry.Release()
+	if err := qry.Exec(); err != errProbe {
+		if err == nil {
+			err = fmt.Errorf("statement could not be prepared")
+		}
+		l.Error(err)
+		return nil, err
+	}
+	return p, nil
+}
+
+// Retryable reports whether err is a timeout or an unavailable error,
+// after which an idempotent statement can be run again.
+func (d *Conn) Retryable(err error) bool {
+	var unavailable *gocql.RequestErrUnavailable
+	var readTimeout *gocql.RequestErrReadTimeout
+	var writeTimeout *gocql.RequestErrWriteTimeout
+	return errors.As(err, &unavailable) ||
+		errors.As(err, &readTimeout) ||
+		errors.As(err, &writeTimeout) ||
+		errors.Is(err, gocql.ErrTimeoutNoResponse)
+}
+
+// bulkBatchSize is the number of rows inserted per unlogged batch.
+const bulkBatchSize = 100
+
+// BulkInsert inserts the request's rows into the table named by the
+// statement with unlogged batches of bulkBatchSize rows. Batches are not
+// atomic, so a failed insert may leave earlier batches applied.
+func (d *Conn) BulkInsert(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "BulkInsert",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debugf("Inserting %d rows into %s", len(r.Rows), r.Statement)
+	types, err := d.columnTypes(r.Statement, r.Columns)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	rows := make([][]any, len(r.Rows))
+	for i, row := range r.Rows {
+		if rows[i], err = convertRow(types, row); err != nil {
+			l.Error(err)
+			return &schema.Response{
+				Results: nil,
+				Error:   fmt.Errorf("rows[%d]: %w", i, err),
+			}
+		}
+	}
+	stmt := "INSERT INTO " + r.Statement + " (" + strings.Join(r.Columns, ", ") + ") VALUES (" +
+		strings.TrimSuffix(strings.Repeat("?, ", len(r.Columns)), ", ") + ")"
+	for start := 0; start < len(r.Rows); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(r.Rows) {
+			end = len(r.Rows)
+		}
+		b := d.Client.NewBatch(gocql.UnloggedBatch)
+		if r.Options.Consistency != "" {
+			c, err := gocql.ParseConsistencyWrapper(r.Options.Consistency)
+			if err != nil {
+				return &schema.Response{
+					Results: nil,
+					Error:   err,
+				}
+			}
+			b.SetConsistency(c)
+		}
+		for _, row := range rows[start:end] {
+			b.Query(stmt, row...)
+		}
+		if err := d.Client.ExecuteBatch(b); err != nil {
+			l.Error(err)
+			return &schema.Response{
+				Results: nil,
+				Error:   fmt.Errorf("inserted %d of %d rows: %w", start, len(r.Rows), err),
+			}
+		}
+	}
+	res.Results = []map[string]any{{"rows_affected": len(r.Rows)}}
+	return res
+}
+
+// columnTypes returns the types of the columns of the table named by
+// table, which is qualified by its keyspace or in the session's keyspace.
+func (d *Conn) columnTypes(table string, columns []string) ([]gocql.TypeInfo, error) {
+	ks, name := d.Keyspace, table
+	if k, t, ok := strings.Cut(table, "."); ok {
+		ks, name = k, t
+	}
+	if ks == "" {
+		return nil, fmt.Errorf("table %s must be qualified by its keyspace", table)
+	}
+	md, err := d.Client.KeyspaceMetadata(strings.ToLower(ks))
+	if err != nil {
+		return nil, err
+	}
+	t, ok := md.Tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	types := make([]gocql.TypeInfo, len(columns))
+	for i, c := range columns {
+		col, ok := t.Columns[strings.ToLower(c)]
+		if !ok {
+			return nil, fmt.Errorf("column %s does not exist in %s", c, table)
+		}
+		types[i] = col.Type
+	}
+	return types, nil
+}
+
+// convertRow converts the values of a bulk insert row to the types of
+// their columns.
+func convertRow(types []gocql.TypeInfo, row []any) ([]any, error) {
+	out := make([]any, len(row))
+	for i, v := range row {
+		cv, err := convertValue(types[i], v)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", i+1, err)
+		}
+		out[i] = cv
+	}
+	return out, nil
+}
+
+// convertValue converts a string or JSON number to a value gocql marshals
+// into a column of type t. CSV rows hold only strings, and JSON rows hold
+// numbers as float64, which gocql does not marshal into every column type.
+// Empty strings are null for columns which are not text.
+func convertValue(t gocql.TypeInfo, v any) (any, error) {
+	typ := t.Type()
+	switch typ {
+	case gocql.TypeAscii, gocql.TypeText, gocql.TypeVarchar:
+		return v, nil
+	}
+	switch x := v.(type) {
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" {
+			return nil, nil
+		}
+		switch typ {
+		case gocql.TypeBoolean:
+			return strconv.ParseBool(s)
+		case gocql.TypeFloat:
+			f, err := strconv.ParseFloat(s, 32)
+			return float32(f), err
+		case gocql.TypeDouble:
+			return strconv.ParseFloat(s, 64)
+		case gocql.TypeDecimal:
+			d, ok := new(inf.Dec).SetString(s)
+			if !ok {
+				return nil, fmt.Errorf("invalid decimal %q", s)
+			}
+			return d, nil
+		case gocql.TypeVarint:
+			b, ok := new(big.Int).SetString(s, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid varint %q", s)
+			}
+			return b, nil
+		case gocql.TypeTimestamp:
+			return time.Parse(time.RFC3339Nano, s)
+		case gocql.TypeBlob:
+			return base64.StdEncoding.DecodeString(s)
+		}
+		return s, nil
+	case float64:
+		switch typ {
+		case gocql.TypeTinyInt, gocql.TypeSmallInt, gocql.TypeInt, gocql.TypeBigInt, gocql.TypeCounter, gocql.TypeVarint:
+			if x != math.Trunc(x) {
+				return nil, fmt.Errorf("%v is not an integer", x)
+			}
+			if typ == gocql.TypeVarint {
+				b, _ := big.NewFloat(x).Int(nil)
+				return b, nil
+			}
+			return int64(x), nil
+		case gocql.TypeFloat:
+			return float32(x), nil
+		case gocql.TypeDecimal:
+			d, _ := new(inf.Dec).SetString(strconv.FormatFloat(x, 'f', -1, 64))
+			return d, nil
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,66 @@
+package cql
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+)
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     gocql.Type
+		v       any
+		want    any
+		wantErr bool
+	}{
+		{"text", gocql.TypeText, "  a ", "  a ", false},
+		{"empty text", gocql.TypeVarchar, "", "", false},
+		{"empty int", gocql.TypeInt, "", nil, false},
+		{"int string", gocql.TypeInt, "42", "42", false},
+		{"int float", gocql.TypeBigInt, float64(42), int64(42), false},
+		{"int fraction", gocql.TypeInt, 1.5, nil, true},
+		{"bool", gocql.TypeBoolean, "true", true, false},
+		{"bad bool", gocql.TypeBoolean, "yes please", nil, true},
+		{"float", gocql.TypeFloat, "1.5", float32(1.5), false},
+		{"double", gocql.TypeDouble, "1.25", 1.25, false},
+		{"decimal", gocql.TypeDecimal, "12345678901234567890.12", "12345678901234567890.12", false},
+		{"decimal float", gocql.TypeDecimal, 1.5, "1.5", false},
+		{"bad decimal", gocql.TypeDecimal, "1.2.3", nil, true},
+		{"varint", gocql.TypeVarint, "123456789012345678901234567890", "123456789012345678901234567890", false},
+		{"timestamp", gocql.TypeTimestamp, "2023-01-02T03:04:05Z", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"bad timestamp", gocql.TypeTimestamp, "yesterday", nil, true},
+		{"blob", gocql.TypeBlob, "AAE=", "\x00\x01", false},
+		{"bool value", gocql.TypeBoolean, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertValue(gocql.NewNativeType(4, tt.typ, ""), tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			switch g := got.(type) {
+			case *inf.Dec:
+				got = g.String()
+			case *big.Int:
+				got = g.String()
+			case []byte:
+				got = string(g)
+			case time.Time:
+				if !g.Equal(tt.want.(time.Time)) {
+					t.Errorf("convertValue() = %v, want %v", g, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("convertValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
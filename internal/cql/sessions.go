@@ -0,0 +1,184 @@
+package cql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSessionIdleTimeout is how long an unused session is kept open.
+	defaultSessionIdleTimeout = 10 * time.Minute
+	// defaultMaxSessions is the number of sessions kept open.
+	defaultMaxSessions = 32
+	// sweepInterval is how often idle sessions are closed.
+	sweepInterval = time.Minute
+)
+
+// session is the part of a gocql session the cache uses.
+type session interface {
+	Close()
+	Closed() bool
+}
+
+type sessionEntry struct {
+	session  session
+	refs     int
+	lastUsed time.Time
+}
+
+// sessionCache keeps sessions open between requests with the same
+// connection params, so the statements prepared by gocql are reused.
+// Sessions which are not in use are closed once they have been idle for
+// idleTimeout, and the least recently used of them are closed when more
+// than maxSessions are open.
+type sessionCache struct {
+	idleTimeout time.Duration
+	maxSessions int
+
+	mu        sync.Mutex
+	sessions  map[string]*sessionEntry
+	sweepOnce sync.Once
+}
+
+var sessions = &sessionCache{
+	idleTimeout: sessionIdleTimeoutFromEnv(),
+	maxSessions: maxSessionsFromEnv(),
+}
+
+// sessionIdleTimeoutFromEnv returns how long an unused session is kept
+// open, from CQL_SESSION_IDLE_TIMEOUT. It defaults to 10 minutes.
+func sessionIdleTimeoutFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CQL_SESSION_IDLE_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultSessionIdleTimeout
+}
+
+// maxSessionsFromEnv returns the number of sessions kept open, from
+// CQL_MAX_SESSIONS. It defaults to 32.
+func maxSessionsFromEnv() int {
+	if n, err := strconv.Atoi(os.Getenv("CQL_MAX_SESSIONS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxSessions
+}
+
+// sessionKey returns the session cache key for a driver's connection
+// params.
+func sessionKey(driver string, params map[string]any) (string, error) {
+	jd, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(append([]byte(driver+"\x00"), jd...))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// acquire returns the cached session for key and marks it in use, or nil
+// if there is none.
+func (c *sessionCache) acquire(key string, now time.Time) session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.sessions[key]
+	if e == nil {
+		return nil
+	}
+	if e.session.Closed() {
+		delete(c.sessions, key)
+		return nil
+	}
+	e.refs++
+	e.lastUsed = now
+	return e.session
+}
+
+// store caches s under key and marks it in use. If another request stored
+// a session first, s is closed and the cached session is returned instead.
+func (c *sessionCache) store(key string, s session, now time.Time) session {
+	c.mu.Lock()
+	if c.sessions == nil {
+		c.sessions = map[string]*sessionEntry{}
+	}
+	if e := c.sessions[key]; e != nil && !e.session.Closed() {
+		e.refs++
+		e.lastUsed = now
+		c.mu.Unlock()
+		s.Close()
+		return e.session
+	}
+	c.sessions[key] = &sessionEntry{session: s, refs: 1, lastUsed: now}
+	closed := c.evict(now)
+	c.mu.Unlock()
+	closeAll(closed)
+	return s
+}
+
+// release marks a session acquired or stored under key as no longer in
+// use by one request.
+func (c *sessionCache) release(key string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.sessions[key]; e != nil && e.refs > 0 {
+		e.refs--
+		e.lastUsed = now
+	}
+}
+
+// sweep closes the sessions which have been idle for too long.
+func (c *sessionCache) sweep(now time.Time) {
+	c.mu.Lock()
+	closed := c.evict(now)
+	c.mu.Unlock()
+	closeAll(closed)
+}
+
+// evict removes the idle sessions which are not in use, and then the least
+// recently used sessions which are not in use until at most maxSessions
+// are left, and returns them to be closed. c.mu must be held.
+func (c *sessionCache) evict(now time.Time) []session {
+	var closed []session
+	for k, e := range c.sessions {
+		if e.refs == 0 && (e.session.Closed() || now.Sub(e.lastUsed) >= c.idleTimeout) {
+			closed = append(closed, e.session)
+			delete(c.sessions, k)
+		}
+	}
+	for len(c.sessions) > c.maxSessions {
+		lru := ""
+		for k, e := range c.sessions {
+			if e.refs == 0 && (lru == "" || e.lastUsed.Before(c.sessions[lru].lastUsed)) {
+				lru = k
+			}
+		}
+		if lru == "" {
+			// every session is in use, they are evicted once released
+			break
+		}
+		closed = append(closed, c.sessions[lru].session)
+		delete(c.sessions, lru)
+	}
+	return closed
+}
+
+// startSweeper closes idle sessions in the background, so that they are
+// closed even if no new sessions are opened.
+func (c *sessionCache) startSweeper() {
+	c.sweepOnce.Do(func() {
+		go func() {
+			for now := range time.Tick(sweepInterval) {
+				c.sweep(now)
+			}
+		}()
+	})
+}
+
+func closeAll(ss []session) {
+	for _, s := range ss {
+		s.Close()
+	}
+}
@@ -0,0 +1,89 @@
+package cql
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeSession struct {
+	closed bool
+}
+
+func (s *fakeSession) Close()       { s.closed = true }
+func (s *fakeSession) Closed() bool { return s.closed }
+
+func TestSessionCacheIdle(t *testing.T) {
+	c := &sessionCache{idleTimeout: time.Minute, maxSessions: 10}
+	now := time.Now()
+	s := &fakeSession{}
+	c.store("a", s, now)
+	c.sweep(now.Add(2 * time.Minute))
+	if s.closed {
+		t.Fatal("session in use was closed")
+	}
+	c.release("a", now.Add(2*time.Minute))
+	c.sweep(now.Add(2*time.Minute + 30*time.Second))
+	if s.closed {
+		t.Fatal("session was closed before its idle timeout")
+	}
+	if got := c.acquire("a", now.Add(2*time.Minute+30*time.Second)); got != s {
+		t.Fatal("cached session was not returned")
+	}
+	c.release("a", now.Add(3*time.Minute))
+	c.sweep(now.Add(4 * time.Minute))
+	if !s.closed {
+		t.Fatal("idle session was not closed")
+	}
+	if got := c.acquire("a", now.Add(4*time.Minute)); got != nil {
+		t.Fatal("closed session was returned")
+	}
+}
+
+func TestSessionCacheLRU(t *testing.T) {
+	c := &sessionCache{idleTimeout: time.Hour, maxSessions: 2}
+	now := time.Now()
+	a, b, d := &fakeSession{}, &fakeSession{}, &fakeSession{}
+	c.store("a", a, now)
+	c.store("b", b, now.Add(time.Second))
+	c.release("a", now.Add(2*time.Second))
+	c.release("b", now.Add(3*time.Second))
+	c.store("d", d, now.Add(4*time.Second))
+	if !a.closed || b.closed || d.closed {
+		t.Fatalf("closed a, b, d = %v, %v, %v, want only a", a.closed, b.closed, d.closed)
+	}
+}
+
+func TestSessionCacheLRUInUse(t *testing.T) {
+	c := &sessionCache{idleTimeout: time.Hour, maxSessions: 1}
+	now := time.Now()
+	a, b := &fakeSession{}, &fakeSession{}
+	c.store("a", a, now)
+	c.store("b", b, now.Add(time.Second))
+	if a.closed || b.closed {
+		t.Fatal("session in use was closed")
+	}
+	c.release("a", now.Add(2*time.Second))
+	c.sweep(now.Add(3 * time.Second))
+	if !a.closed || b.closed {
+		t.Fatalf("closed a, b = %v, %v, want only a", a.closed, b.closed)
+	}
+}
+
+func TestSessionCacheStoreRace(t *testing.T) {
+	c := &sessionCache{idleTimeout: time.Hour, maxSessions: 10}
+	now := time.Now()
+	a, b := &fakeSession{}, &fakeSession{}
+	c.store("k", a, now)
+	if got := c.store("k", b, now); got != a || !b.closed {
+		t.Fatal("second session for the same key was kept")
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	params := map[string]any{"hosts": "a", "keyspace": "k"}
+	k1, _ := sessionKey("cassandra", params)
+	k2, _ := sessionKey("scylla", params)
+	if k1 == k2 {
+		t.Fatal("drivers share a session key")
+	}
+}
@@ -0,0 +1,249 @@
+package freeze
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/robertlestak/sigc/internal/cache"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// Freeze scopes.
+const (
+	ScopeGlobal     = "global"
+	ScopeDriver     = "driver"
+	ScopeConnection = "connection"
+	ScopePrincipal  = "principal"
+)
+
+// Freeze stops the executions of the signed requests in its scope, without
+// deleting their keys. A freeze applies from Start until End, or
+// indefinitely if they are not set, and if it has Windows only while one of
+// them is open.
+type Freeze struct {
+	Scope string `json:"scope"`
+	// Value is the driver, connection fingerprint or signer principal the
+	// freeze applies to. It is empty for the global scope.
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Start and End are Unix timestamps. The freeze is deleted at End.
+	Start   int64               `json:"start,omitempty"`
+	End     int64               `json:"end,omitempty"`
+	Windows []schema.TimeWindow `json:"windows,omitempty"`
+	// CreatedBy is the admin principal which created the freeze, at the
+	// Unix time CreatedAt.
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+}
+
+// FrozenError is returned when a signed request is executed while a freeze
+// applies to it.
+type FrozenError struct {
+	Freeze *Freeze
+}
+
+func (e *FrozenError) Error() string {
+	msg := "executions are frozen"
+	if e.Freeze.Scope != ScopeGlobal {
+		msg += fmt.Sprintf(" for %s %s", e.Freeze.Scope, e.Freeze.Value)
+	}
+	if e.Freeze.Reason != "" {
+		msg += ": " + e.Freeze.Reason
+	}
+	return msg
+}
+
+// RetryAfter returns the time until the freeze ends, or 0 if it is not
+// known.
+func (e *FrozenError) RetryAfter(now time.Time) time.Duration {
+	if e.Freeze.End == 0 || len(e.Freeze.Windows) > 0 {
+		return 0
+	}
+	return time.Unix(e.Freeze.End, 0).Sub(now)
+}
+
+// Validate checks the freeze.
+func (f *Freeze) Validate(now time.Time) error {
+	switch f.Scope {
+	case ScopeGlobal:
+		if f.Value != "" {
+			return errors.New("value must be empty for scope global")
+		}
+	case ScopeDriver, ScopePrincipal:
+		if f.Value == "" {
+			return fmt.Errorf("value is required for scope %s", f.Scope)
+		}
+	case ScopeConnection:
+		f.Value = strings.ToLower(f.Value)
+		if b, err := hex.DecodeString(f.Value); err != nil || len(b) != 16 {
+			return errors.New("value must be a connection fingerprint for scope connection")
+		}
+	default:
+		return fmt.Errorf("scope must be %s, %s, %s or %s", ScopeGlobal, ScopeDriver, ScopeConnection, ScopePrincipal)
+	}
+	if f.Start < 0 || f.End < 0 {
+		return errors.New("start and end must be equal or greater than 0")
+	}
+	if f.End > 0 && f.End <= now.Unix() {
+		return errors.New("end must be in the future")
+	}
+	if f.Start > 0 && f.End > 0 && f.Start >= f.End {
+		return errors.New("start must be before end")
+	}
+	for i := range f.Windows {
+		if err := f.Windows[i].Validate(); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Active reports whether the freeze applies at now.
+func (f *Freeze) Active(now time.Time) bool {
+	if f.Start > 0 && now.Before(time.Unix(f.Start, 0)) {
+		return false
+	}
+	if f.End > 0 && !now.Before(time.Unix(f.End, 0)) {
+		return false
+	}
+	if len(f.Windows) == 0 {
+		return true
+	}
+	for i := range f.Windows {
+		w := &f.Windows[i]
+		if err := w.Validate(); err == nil && w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func key(scope, value string) string {
+	return cache.FreezesPrefix + scope + ":" + value
+}
+
+// Set stores the freeze, replacing any freeze of the same scope and value.
+func Set(f *Freeze) error {
+	l := log.WithFields(log.Fields{
+		"app":   "freeze",
+		"fn":    "Set",
+		"scope": f.Scope,
+		"value": f.Value,
+	})
+	l.Debug("start")
+	now := time.Now()
+	if err := f.Validate(now); err != nil {
+		return err
+	}
+	f.CreatedAt = now.Unix()
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if f.End > 0 {
+		ttl = time.Unix(f.End, 0).Sub(now)
+	}
+	return cache.Client.Set(key(f.Scope, f.Value), b, ttl).Err()
+}
+
+// Delete deletes the freeze of scope and value, and returns an error if
+// there is none.
+func Delete(scope, value string) error {
+	l := log.WithFields(log.Fields{
+		"app":   "freeze",
+		"fn":    "Delete",
+		"scope": scope,
+		"value": value,
+	})
+	l.Debug("start")
+	if scope == ScopeConnection {
+		value = strings.ToLower(value)
+	}
+	n, err := cache.Client.Del(key(scope, value)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("freeze not found")
+	}
+	return nil
+}
+
+// List returns every stored freeze, including scheduled freezes which do
+// not apply yet.
+func List() ([]*Freeze, error) {
+	l := log.WithFields(log.Fields{
+		"app": "freeze",
+		"fn":  "List",
+	})
+	l.Debug("start")
+	fs := []*Freeze{}
+	var cursor uint64
+	for {
+		var keys []string
+		var err error
+		keys, cursor, err = cache.Client.Scan(cursor, cache.FreezesPrefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			b, err := cache.Client.Get(k).Bytes()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			f := &Freeze{}
+			if err := json.Unmarshal(b, f); err != nil {
+				l.WithError(err).Errorf("invalid freeze %s", k)
+				continue
+			}
+			fs = append(fs, f)
+		}
+		if cursor == 0 {
+			return fs, nil
+		}
+	}
+}
+
+// Check returns a *FrozenError if a freeze applies to executions of the
+// driver, the connection with the fingerprint or the requests signed by the
+// principal.
+func Check(driver, fingerprint, principal string) error {
+	l := log.WithFields(log.Fields{
+		"app": "freeze",
+		"fn":  "Check",
+	})
+	l.Debug("start")
+	keys := []string{key(ScopeGlobal, ""), key(ScopeDriver, driver), key(ScopeConnection, fingerprint)}
+	if principal != "" {
+		keys = append(keys, key(ScopePrincipal, principal))
+	}
+	vals, err := cache.Client.MGet(keys...).Result()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		f := &Freeze{}
+		if err := json.Unmarshal([]byte(s), f); err != nil {
+			l.WithError(err).Errorf("invalid freeze %s", keys[i])
+			continue
+		}
+		if f.Active(now) {
+			return &FrozenError{Freeze: f}
+		}
+	}
+	return nil
+}
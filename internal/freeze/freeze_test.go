@@ -0,0 +1,90 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+func TestFreezeActive(t *testing.T) {
+	// a friday
+	now := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	hour := int64(time.Hour / time.Second)
+	lunch := []schema.TimeWindow{{Days: []string{"mon-fri"}, Start: "11:00", End: "13:00"}}
+	nights := []schema.TimeWindow{{Start: "22:00", End: "06:00"}}
+	tests := []struct {
+		name   string
+		freeze Freeze
+		want   bool
+	}{
+		{"indefinite", Freeze{Scope: ScopeGlobal}, true},
+		{"started", Freeze{Scope: ScopeGlobal, Start: now.Unix() - hour}, true},
+		{"at start", Freeze{Scope: ScopeGlobal, Start: now.Unix()}, true},
+		{"not started", Freeze{Scope: ScopeGlobal, Start: now.Unix() + 1}, false},
+		{"before end", Freeze{Scope: ScopeGlobal, End: now.Unix() + 1}, true},
+		{"at end", Freeze{Scope: ScopeGlobal, End: now.Unix()}, false},
+		{"ended", Freeze{Scope: ScopeGlobal, Start: now.Unix() - 2*hour, End: now.Unix() - hour}, false},
+		{"in window", Freeze{Scope: ScopeGlobal, Windows: lunch}, true},
+		{"outside window", Freeze{Scope: ScopeGlobal, Windows: nights}, false},
+		{"in one of the windows", Freeze{Scope: ScopeGlobal, Windows: append(append([]schema.TimeWindow{}, nights...), lunch...)}, true},
+		{"in window not started", Freeze{Scope: ScopeGlobal, Start: now.Unix() + hour, Windows: lunch}, false},
+		{"in window ended", Freeze{Scope: ScopeGlobal, End: now.Unix() - hour, Windows: lunch}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.freeze.Active(now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrozenErrorRetryAfter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		freeze Freeze
+		want   time.Duration
+	}{
+		{"indefinite", Freeze{Scope: ScopeGlobal}, 0},
+		{"end", Freeze{Scope: ScopeGlobal, End: now.Unix() + 90}, 90 * time.Second},
+		{"windows", Freeze{Scope: ScopeGlobal, End: now.Unix() + 90, Windows: []schema.TimeWindow{{Start: "09:00", End: "17:00"}}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &FrozenError{Freeze: &tt.freeze}
+			if got := e.RetryAfter(now); got != tt.want {
+				t.Errorf("RetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreezeValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		freeze  Freeze
+		wantErr bool
+	}{
+		{"global", Freeze{Scope: ScopeGlobal}, false},
+		{"global with value", Freeze{Scope: ScopeGlobal, Value: "postgres"}, true},
+		{"driver", Freeze{Scope: ScopeDriver, Value: "postgres"}, false},
+		{"driver without value", Freeze{Scope: ScopeDriver}, true},
+		{"connection", Freeze{Scope: ScopeConnection, Value: "00112233445566778899AABBCCDDEEFF"}, false},
+		{"connection not a fingerprint", Freeze{Scope: ScopeConnection, Value: "db.internal"}, true},
+		{"unknown scope", Freeze{Scope: "table"}, true},
+		{"end in the past", Freeze{Scope: ScopeGlobal, End: now.Unix()}, true},
+		{"start after end", Freeze{Scope: ScopeGlobal, Start: now.Unix() + 20, End: now.Unix() + 10}, true},
+		{"invalid window", Freeze{Scope: ScopeGlobal, Windows: []schema.TimeWindow{{Start: "09:00"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.freeze.Validate(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/robertlestak/sigc/internal/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// Idempotency states.
+const (
+	IdempotencyPending  = "pending"
+	IdempotencyComplete = "complete"
+)
+
+// MaxIdempotencyKeyLength is the maximum length of an idempotency key.
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrIdempotencyInFlight is returned when a request with an idempotency
+	// key is executed while an earlier execution with the key is pending.
+	ErrIdempotencyInFlight = errors.New("a request with this idempotency key is in progress")
+	// ErrIdempotencyMismatch is returned when an idempotency key is reused
+	// with different params.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used with different params")
+)
+
+// Idempotent is the state of the executions of a key with an idempotency
+// key.
+type Idempotent struct {
+	State      string          `json:"state"`
+	ParamsHash string          `json:"params_hash"`
+	Response   json.RawMessage `json:"response,omitempty"`
+}
+
+func idempotencyKey(keyID, key string) string {
+	return cache.IdempotencyPrefix + keyID + ":" + key
+}
+
+// BeginIdempotent marks the execution of keyID with the idempotency key
+// and paramsHash as pending, for at most lease, after which it can be
+// retried. If an earlier execution with the key is complete it is
+// returned, and if it is pending or had other params an error is returned.
+func BeginIdempotent(keyID, key, paramsHash string, lease time.Duration) (*Idempotent, error) {
+	l := log.WithFields(log.Fields{
+		"func": "BeginIdempotent",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	if len(key) > MaxIdempotencyKeyLength {
+		return nil, fmt.Errorf("idempotency key must be at most %d characters", MaxIdempotencyKeyLength)
+	}
+	b, err := json.Marshal(&Idempotent{State: IdempotencyPending, ParamsHash: paramsHash})
+	if err != nil {
+		return nil, err
+	}
+	k := idempotencyKey(keyID, key)
+	ok, err := cache.Client.SetNX(k, b, lease).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+	sb, err := cache.Client.Get(k).Bytes()
+	if err == redis.Nil {
+		// the earlier execution was released or expired in between
+		return nil, ErrIdempotencyInFlight
+	} else if err != nil {
+		return nil, err
+	}
+	prev := &Idempotent{}
+	if err := json.Unmarshal(sb, prev); err != nil {
+		return nil, err
+	}
+	if prev.ParamsHash != paramsHash {
+		return nil, ErrIdempotencyMismatch
+	}
+	if prev.State != IdempotencyComplete {
+		return nil, ErrIdempotencyInFlight
+	}
+	return prev, nil
+}
+
+// CompleteIdempotent stores the response of the pending execution of keyID
+// with the idempotency key, for ttl.
+func CompleteIdempotent(keyID, key, paramsHash string, response []byte, ttl time.Duration) error {
+	l := log.WithFields(log.Fields{
+		"func": "CompleteIdempotent",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	b, err := json.Marshal(&Idempotent{State: IdempotencyComplete, ParamsHash: paramsHash, Response: response})
+	if err != nil {
+		return err
+	}
+	return cache.Client.Set(idempotencyKey(keyID, key), b, ttl).Err()
+}
+
+// ReleaseIdempotent deletes the pending execution of keyID with the
+// idempotency key, for requests which were not executed, so that they can
+// be retried.
+func ReleaseIdempotent(keyID, key string) error {
+	l := log.WithFields(log.Fields{
+		"func": "ReleaseIdempotent",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	return cache.Client.Del(idempotencyKey(keyID, key)).Err()
+}
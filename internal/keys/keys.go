@@ -7,8 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-redis/redis"
 	"github.com/google/uuid"
 	"github.com/robertlestak/sigc/internal/cache"
+	"github.com/robertlestak/sigc/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -23,15 +25,24 @@ type SignKey struct {
 	ExpiresAt int64
 	MaxUses   int
 	Uses      int
+	SignedBy  string
+	// IdleTimeout is the number of seconds after LastUsedAt the key
+	// expires, if it is greater than 0. LastUsedAt is the Unix time the key
+	// was last used, or created.
+	IdleTimeout int64
+	LastUsedAt  int64
 }
 
 func (s *SignKey) MarshalMap() map[string]interface{} {
 	return map[string]interface{}{
-		"key_id":     s.KeyID,
-		"key_bytes":  string(s.KeyBytes),
-		"expires_at": strconv.FormatInt(s.ExpiresAt, 10),
-		"max_uses":   strconv.FormatInt(int64(s.MaxUses), 10),
-		"uses":       strconv.FormatInt(int64(s.Uses), 10),
+		"key_id":       s.KeyID,
+		"key_bytes":    string(s.KeyBytes),
+		"expires_at":   strconv.FormatInt(s.ExpiresAt, 10),
+		"max_uses":     strconv.FormatInt(int64(s.MaxUses), 10),
+		"uses":         strconv.FormatInt(int64(s.Uses), 10),
+		"signed_by":    s.SignedBy,
+		"idle_timeout": strconv.FormatInt(s.IdleTimeout, 10),
+		"last_used_at": strconv.FormatInt(s.LastUsedAt, 10),
 	}
 }
 
@@ -56,9 +67,37 @@ func (s *SignKey) UnmarshalMap(m map[string]string) error {
 		return err
 	}
 	s.Uses = int(imu)
+	s.SignedBy = m["signed_by"]
+	// keys stored before idle timeouts were added have neither field
+	if v, ok := m["idle_timeout"]; ok {
+		if s.IdleTimeout, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	if v, ok := m["last_used_at"]; ok {
+		if s.LastUsedAt, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
 	return nil
 }
 
+// Expired reports whether the key has passed its expiry or has been idle
+// for longer than its idle timeout at now, allowing for skew.
+func (s *SignKey) Expired(now time.Time, skew time.Duration) bool {
+	if s.ExpiresAt > 0 && time.Unix(s.ExpiresAt, 0).Add(skew).Before(now) {
+		return true
+	}
+	// LastUsedAt is truncated to the second, so the key is idle until the
+	// end of the second its timeout ends in
+	if s.IdleTimeout > 0 && time.Unix(s.LastUsedAt+s.IdleTimeout+1, 0).Add(skew).Before(now) {
+		return true
+	}
+	return false
+}
+
 func (s *SignKey) GenerateKeyID() string {
 	s.KeyID = uuid.New().String()
 	return s.KeyID
@@ -85,6 +124,28 @@ func GetKeyID(keyID string) (*SignKey, error) {
 	return sk, nil
 }
 
+// useKeyScript counts a use of a key, unless the key has been deleted or
+// has no uses left, in which case it is deleted. Counting in the key store
+// keeps concurrent uses from being lost.
+//
+// KEYS[1] is the key. ARGV[1] is the time of the use, in Unix seconds.
+//
+// It returns {0} if the key does not exist, {1, uses} if the use is
+// counted, and {2, uses} if the key has no uses left.
+var useKeyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0}
+end
+local max = tonumber(redis.call('HGET', KEYS[1], 'max_uses')) or 0
+local uses = redis.call('HINCRBY', KEYS[1], 'uses', 1)
+if max > 0 and uses > max then
+	redis.call('DEL', KEYS[1])
+	return {2, uses}
+end
+redis.call('HSET', KEYS[1], 'last_used_at', ARGV[1])
+return {1, uses}
+`)
+
 func UseKeyID(keyID string) error {
 	l := log.WithFields(log.Fields{
 		"func": "UseKeyID",
@@ -95,18 +156,52 @@ func UseKeyID(keyID string) error {
 	if err != nil {
 		return err
 	}
-	sk.Uses++
-	if sk.MaxUses > 0 && sk.Uses > sk.MaxUses {
+	now := time.Now()
+	if sk.Expired(now, utils.ClockSkew()) {
 		cache.Client.Del(cache.KeysPrefix + keyID)
-		return fmt.Errorf("key %s has been used %d times, max is %d", keyID, sk.Uses, sk.MaxUses)
+		return fmt.Errorf("key %s has expired", keyID)
+	}
+	res, err := useKeyScript.Run(cache.Client, []string{cache.KeysPrefix + keyID}, now.Unix()).Result()
+	if err != nil {
+		return err
+	}
+	vals, ok := res.([]any)
+	if !ok || len(vals) == 0 {
+		return fmt.Errorf("unexpected use result %v", res)
+	}
+	switch vals[0] {
+	case int64(0):
+		return fmt.Errorf("key not found")
+	case int64(1):
+		return nil
+	case int64(2):
+		return fmt.Errorf("key %s has been used %v times, max is %d", keyID, vals[1], sk.MaxUses)
 	}
-	if err := cache.Client.HMSet(cache.KeysPrefix+keyID, sk.MarshalMap()).Err(); err != nil {
+	return fmt.Errorf("unexpected use result %v", res)
+}
+
+// UseNonce records that nonce has been used with keyID, and returns an error
+// if it already was. Nonces are kept for ttl.
+func UseNonce(keyID, nonce string, ttl time.Duration) error {
+	l := log.WithFields(log.Fields{
+		"func": "UseNonce",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	ok, err := cache.Client.SetNX(cache.NoncesPrefix+keyID+":"+nonce, 1, ttl).Result()
+	if err != nil {
 		return err
 	}
+	if !ok {
+		return fmt.Errorf("nonce %s has already been used", nonce)
+	}
 	return nil
 }
 
-func LoadPrivateKey(key []byte, maxUses int, expiresAt int64) (*SignKey, error) {
+// LoadPrivateKey stores key under a new key ID, recording the principal
+// which signed the request. If idleTimeout is greater than 0 the key
+// expires once it has not been used for idleTimeout.
+func LoadPrivateKey(key []byte, maxUses int, expiresAt int64, signedBy string, idleTimeout time.Duration) (*SignKey, error) {
 	l := log.WithFields(log.Fields{
 		"app": "keys",
 		"fn":  "LoadPrivateKey",
@@ -116,6 +211,10 @@ func LoadPrivateKey(key []byte, maxUses int, expiresAt int64) (*SignKey, error)
 		KeyBytes:  key,
 		MaxUses:   maxUses,
 		ExpiresAt: expiresAt,
+		SignedBy:  signedBy,
+		// the idle timeout runs from creation until the first use
+		IdleTimeout: int64(idleTimeout / time.Second),
+		LastUsedAt:  time.Now().Unix(),
 	}
 	sk.GenerateKeyID()
 	cache.Client.HMSet(cache.KeysPrefix+sk.KeyID, sk.MarshalMap())
@@ -165,7 +264,7 @@ func Expirer() {
 					l.Error(err)
 					continue
 				}
-				if sk.ExpiresAt > 0 && sk.ExpiresAt < time.Now().Unix() {
+				if sk.Expired(time.Now(), utils.ClockSkew()) {
 					expiredKeys = append(expiredKeys, key)
 				}
 			}
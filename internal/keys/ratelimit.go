@@ -0,0 +1,160 @@
+package keys
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/robertlestak/sigc/internal/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// RateLimit allows at most Limit uses of a key in any Window.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitStatus is the outcome of a rate limited use of a key, for the
+// limit which is closest to being exceeded, or the exceeded limit.
+type RateLimitStatus struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Window    time.Duration
+	// Reset is the time until the oldest use in the window expires, and
+	// RetryAfter the time until a use is allowed again if it is not.
+	Reset      time.Duration
+	RetryAfter time.Duration
+
+	// use is the member which recorded an allowed use, for
+	// ReleaseRateLimits.
+	use string
+}
+
+// rateLimitScript checks and records a use against sliding window logs,
+// one sorted set of use times per limit. Either every limit has room and
+// the use is recorded in all of them, or nothing is recorded. Times are in
+// microseconds, from the clock of the key store so that servers with
+// skewed clocks share the same windows.
+//
+// KEYS are the sorted sets. ARGV[1] is a unique member for the use,
+// followed by the limit and window of each key.
+//
+// It returns {0, i, retry after} if the ith limit is exceeded, and
+// otherwise {1, count, reset, ...} with the count of uses and time until
+// reset of every limit.
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local counts = {}
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i * 2])
+	local window = tonumber(ARGV[1 + i * 2])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	if count >= limit then
+		local expiring = redis.call('ZRANGE', key, count - limit, count - limit, 'WITHSCORES')
+		return {0, i, tonumber(expiring[2]) + window - now}
+	end
+	counts[i] = count
+end
+local result = {1}
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[1 + i * 2])
+	redis.call('ZADD', key, now, ARGV[1])
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	table.insert(result, counts[i] + 1)
+	table.insert(result, tonumber(oldest[2]) + window - now)
+end
+return result
+`)
+
+// UseRateLimits records a use of keyID against its rate limits, if every
+// limit allows it. The limits are kept in the key store so they hold across
+// servers.
+func UseRateLimits(keyID string, limits []RateLimit) (*RateLimitStatus, error) {
+	l := log.WithFields(log.Fields{
+		"func": "UseRateLimits",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	if len(limits) == 0 {
+		return &RateLimitStatus{Allowed: true}, nil
+	}
+	use := uuid.New().String()
+	args := []any{use}
+	for _, rl := range limits {
+		args = append(args, rl.Limit, rl.Window.Microseconds())
+	}
+	res, err := rateLimitScript.Run(cache.Client, rateLimitKeys(keyID, limits), args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	vals, ok := res.([]any)
+	if !ok || len(vals) == 0 {
+		return nil, fmt.Errorf("unexpected rate limit result %v", res)
+	}
+	ints := make([]int64, len(vals))
+	for i, v := range vals {
+		if ints[i], ok = v.(int64); !ok {
+			return nil, fmt.Errorf("unexpected rate limit result %v", res)
+		}
+	}
+	if ints[0] == 0 {
+		rl := limits[ints[1]-1]
+		return &RateLimitStatus{
+			Limit:      rl.Limit,
+			Window:     rl.Window,
+			Reset:      time.Duration(ints[2]) * time.Microsecond,
+			RetryAfter: time.Duration(ints[2]) * time.Microsecond,
+		}, nil
+	}
+	var st *RateLimitStatus
+	for i, rl := range limits {
+		s := &RateLimitStatus{
+			use:       use,
+			Allowed:   true,
+			Limit:     rl.Limit,
+			Remaining: rl.Limit - int(ints[1+i*2]),
+			Window:    rl.Window,
+			Reset:     time.Duration(ints[2+i*2]) * time.Microsecond,
+		}
+		if st == nil || s.Remaining < st.Remaining {
+			st = s
+		}
+	}
+	return st, nil
+}
+
+// ReleaseRateLimits removes the use recorded by UseRateLimits with status
+// st, for requests which were not executed.
+func ReleaseRateLimits(keyID string, limits []RateLimit, st *RateLimitStatus) error {
+	l := log.WithFields(log.Fields{
+		"func": "ReleaseRateLimits",
+		"kid":  keyID,
+	})
+	l.Debug("start")
+	if st == nil || st.use == "" {
+		return nil
+	}
+	p := cache.Client.TxPipeline()
+	for _, k := range rateLimitKeys(keyID, limits) {
+		p.ZRem(k, st.use)
+	}
+	_, err := p.Exec()
+	return err
+}
+
+// rateLimitKeys returns the keys of the use logs of keyID's limits.
+func rateLimitKeys(keyID string, limits []RateLimit) []string {
+	keys := make([]string, len(limits))
+	for i := range limits {
+		keys[i] = cache.RateLimitsPrefix + keyID + ":" + strconv.Itoa(i)
+	}
+	return keys
+}
@@ -0,0 +1,283 @@
+package pgwire
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/lib/pq"
+	"github.com/robertlestak/sigc/internal/utils"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// Conn is a connection to a database which speaks the Postgres wire
+// protocol. It implements the parts of the postgres and cockroachdb
+// drivers which are the same for both.
+type Conn struct {
+	Client      *sql.DB
+	Host        string
+	Port        string
+	User        string
+	Pass        string
+	Db          string
+	SslMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	driver   string
+	pemFiles utils.PEMFiles
+}
+
+// ParseParams parses the connection params shared by the Postgres wire
+// drivers against the driver's params, and returns them for the driver to
+// parse its own params.
+func (d *Conn) ParseParams(specs []schema.ConnectionParam, params map[string]any) (schema.ParamValues, error) {
+	p, err := schema.ParseParams(specs, params)
+	if err != nil {
+		return nil, err
+	}
+	d.Host = p.String("host")
+	if d.Port, err = p.Port("port"); err != nil {
+		return nil, err
+	}
+	d.User = p.String("user")
+	d.Pass = p.String("pass")
+	d.Db = p.String("db")
+	d.SslMode = p.String("sslmode")
+	switch d.SslMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return nil, fmt.Errorf("sslmode must be one of disable, require, verify-ca or verify-full")
+	}
+	d.SSLRootCert = p.String("sslrootcert")
+	d.SSLCert = p.String("sslcert")
+	d.SSLKey = p.String("sslkey")
+	return p, nil
+}
+
+// connStr builds the connection URL with the driver's own options added.
+// Inline PEM certificates and keys are written to private files, as lib/pq
+// only accepts paths.
+func (d *Conn) connStr(opts url.Values) (string, error) {
+	if opts == nil {
+		opts = url.Values{}
+	}
+	opts.Set("sslmode", d.SslMode)
+	for _, p := range []struct {
+		name  string
+		value string
+	}{
+		{"sslrootcert", d.SSLRootCert},
+		{"sslcert", d.SSLCert},
+		{"sslkey", d.SSLKey},
+	} {
+		if p.value == "" {
+			continue
+		}
+		path, err := d.pemFiles.Path(p.name, p.value)
+		if err != nil {
+			return "", err
+		}
+		opts.Set(p.name, path)
+	}
+	u := &url.URL{
+		Scheme:   "postgresql",
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     "/" + d.Db,
+		RawQuery: opts.Encode(),
+	}
+	if d.User != "" && d.Pass != "" {
+		u.User = url.UserPassword(d.User, d.Pass)
+	} else if d.User != "" {
+		u.User = url.User(d.User)
+	}
+	return u.String(), nil
+}
+
+// Open connects to the database of the parsed params. opts, if set, are
+// added to the connection URL.
+func (d *Conn) Open(driver string, opts url.Values) error {
+	d.driver = driver
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Open",
+	})
+	l.Debug("start")
+	connStr, err := d.connStr(opts)
+	if err != nil {
+		l.Error(err)
+		d.pemFiles.Remove()
+		return err
+	}
+	l.Debugf("Connecting to %s:%s/%s", d.Host, d.Port, d.Db)
+	d.Client, err = sql.Open("postgres", connStr)
+	if err != nil {
+		l.Error(err)
+		d.pemFiles.Remove()
+		return err
+	}
+	err = d.Client.Ping()
+	if err != nil {
+		l.Error(err)
+		d.Client.Close()
+		d.pemFiles.Remove()
+		return err
+	}
+	l.Debug("Connected")
+	return nil
+}
+
+func (d *Conn) Disconnect() error {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Disconnect",
+	})
+	l.Debug("start")
+	err := d.Client.Close()
+	d.pemFiles.Remove()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debug("Disconnected")
+	return nil
+}
+
+func (d *Conn) Exec(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Exec",
+	})
+	l.Debug("start")
+	var err error
+	res := &schema.Response{}
+	l.Debug("Executing statement: ", r.Statement)
+	stmt, params, err := utils.ExpandArrays(r.Statement, r.Params, r.ParamTypes)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	sets, err := schema.QueryResultSets(d.Client, r.Options.Transaction, stmt, params, utils.RowsToMapSlice)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.SetResultSets(sets)
+	return res
+}
+
+// Prepare prepares the statement without executing it and returns the
+// number and inferred types of its params.
+func (d *Conn) Prepare(statement string) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "Prepare",
+	})
+	l.Debug("start")
+	n, err := utils.NumInput(d.Client, statement)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	p := &schema.Probe{ParamCount: n}
+	if n > 0 {
+		p.ParamTypes = d.paramTypes(statement)
+	}
+	return p, nil
+}
+
+// paramTypes looks up the param types the server infers for statement. It
+// is best effort and returns nil if the types can not be looked up.
+func (d *Conn) paramTypes(statement string) []string {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "paramTypes",
+	})
+	ctx := context.Background()
+	conn, err := d.Client.Conn(ctx)
+	if err != nil {
+		l.Debug(err)
+		return nil
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PREPARE sigc_probe AS "+statement); err != nil {
+		l.Debug(err)
+		return nil
+	}
+	defer conn.ExecContext(ctx, "DEALLOCATE sigc_probe")
+	var types pq.StringArray
+	err = conn.QueryRowContext(ctx, "SELECT parameter_types::text[] FROM pg_prepared_statements WHERE name = 'sigc_probe'").Scan(&types)
+	if err != nil {
+		l.Debug(err)
+		return nil
+	}
+	return types
+}
+
+// Retryable reports whether err is a serialization failure (40001) or a
+// deadlock (40P01), after which the statement can be run again.
+func (d *Conn) Retryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// BulkInsert copies the request's rows into the table named by the
+// statement with COPY FROM STDIN, in a single transaction.
+func (d *Conn) BulkInsert(r *schema.Request) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": d.driver,
+		"fn":  "BulkInsert",
+	})
+	l.Debug("start")
+	res := &schema.Response{}
+	l.Debugf("Copying %d rows into %s", len(r.Rows), r.Statement)
+	s, t, err := schema.SplitTableName(r.Statement)
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	copyIn := pq.CopyIn(t, r.Columns...)
+	if s != "" {
+		copyIn = pq.CopyInSchema(s, t, r.Columns...)
+	}
+	err = utils.WithConn(d.Client, true, func(q utils.Querier) error {
+		stmt, err := q.PrepareContext(context.Background(), copyIn)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range r.Rows {
+			if _, err := stmt.Exec(row...); err != nil {
+				return err
+			}
+		}
+		_, err = stmt.Exec()
+		return err
+	})
+	if err != nil {
+		l.Error(err)
+		return &schema.Response{
+			Results: nil,
+			Error:   err,
+		}
+	}
+	res.Results = []map[string]any{{"rows_affected": len(r.Rows)}}
+	return res
+}
@@ -0,0 +1,61 @@
+package pgwire
+
+import (
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestConnStr(t *testing.T) {
+	pem := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	tests := []struct {
+		name string
+		conn Conn
+		opts url.Values
+		want string
+	}{
+		{
+			name: "user and pass",
+			conn: Conn{Host: "db", Port: "5432", User: "u", Pass: "p@ss/word", Db: "app", SslMode: "disable"},
+			want: "postgresql://u:p%40ss%2Fword@db:5432/app?sslmode=disable",
+		},
+		{
+			name: "user only",
+			conn: Conn{Host: "::1", Port: "26257", User: "u", Db: "app", SslMode: "require"},
+			want: "postgresql://u@[::1]:26257/app?sslmode=require",
+		},
+		{
+			name: "driver options",
+			conn: Conn{Host: "db", Port: "26257", User: "u", Db: "app", SslMode: "verify-full", SSLRootCert: "/etc/ca.pem"},
+			opts: url.Values{"options": {"--cluster=c1"}},
+			want: "postgresql://u@db:26257/app?options=--cluster%3Dc1&sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.conn.connStr(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("connStr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	t.Run("inline pem", func(t *testing.T) {
+		d := &Conn{Host: "db", Port: "5432", Db: "app", SslMode: "verify-ca", SSLRootCert: pem}
+		got, err := d.connStr(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.pemFiles.Remove()
+		u, err := url.Parse(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(u.Query().Get("sslrootcert"))
+		if err != nil || string(b) != pem {
+			t.Errorf("sslrootcert = %q, %v", b, err)
+		}
+	})
+}
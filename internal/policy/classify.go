@@ -0,0 +1,192 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+// Statement classes.
+const (
+	ClassRead  = "read"
+	ClassWrite = "write"
+	ClassDDL   = "ddl"
+	ClassCall  = "call"
+	ClassOther = "other"
+)
+
+var (
+	sqlReadKeywords = map[string]bool{
+		"SELECT": true, "SHOW": true, "EXPLAIN": true, "DESCRIBE": true,
+		"DESC": true, "VALUES": true, "TABLE": true,
+	}
+	sqlWriteKeywords = map[string]bool{
+		"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true,
+		"UPSERT": true, "REPLACE": true, "COPY": true, "BEGIN": true,
+		"APPLY": true,
+	}
+	sqlDDLKeywords = map[string]bool{
+		"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true,
+		"GRANT": true, "REVOKE": true, "RENAME": true, "COMMENT": true,
+	}
+	sqlCallKeywords = map[string]bool{
+		"CALL": true, "EXEC": true, "EXECUTE": true,
+	}
+	// writeCTERe finds data modifying statements in a WITH query.
+	writeCTERe = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE)\b`)
+	// selectIntoRe finds SELECT ... INTO, which creates or writes a table
+	// or file.
+	selectIntoRe = regexp.MustCompile(`(?i)\bINTO\b`)
+)
+
+// Classify returns the classes of the statements of a request. SQL and CQL
+// batches are split into their statements, and a request is only of a
+// single class if all of its statements are. Classification is by keyword
+// and is not a substitute for a read only database user: a SELECT can call
+// functions with side effects.
+func Classify(driver, kind, statement string) []string {
+	switch kind {
+	case "call":
+		return []string{ClassCall}
+	case "bulk":
+		return []string{ClassWrite}
+	}
+	switch driver {
+	case "http":
+		return []string{classifyHTTP(statement)}
+	case "mongodb":
+		return []string{classifyMongo(statement)}
+	case "redis":
+		return []string{classifyRedis(statement)}
+	}
+	var classes []string
+	seen := map[string]bool{}
+	for _, s := range splitStatements(statement) {
+		c := classifySQL(s)
+		if !seen[c] {
+			seen[c] = true
+			classes = append(classes, c)
+		}
+	}
+	if len(classes) == 0 {
+		return []string{ClassOther}
+	}
+	return classes
+}
+
+func classifySQL(s string) string {
+	f := strings.Fields(s)
+	if len(f) == 0 {
+		return ClassOther
+	}
+	kw := strings.ToUpper(strings.TrimLeft(f[0], "("))
+	switch {
+	case kw == "WITH":
+		if writeCTERe.MatchString(s) {
+			return ClassWrite
+		}
+		return ClassRead
+	case kw == "SELECT" && selectIntoRe.MatchString(s):
+		return ClassWrite
+	case sqlReadKeywords[kw]:
+		return ClassRead
+	case sqlWriteKeywords[kw]:
+		return ClassWrite
+	case sqlDDLKeywords[kw]:
+		return ClassDDL
+	case sqlCallKeywords[kw]:
+		return ClassCall
+	}
+	return ClassOther
+}
+
+func classifyHTTP(statement string) string {
+	var t struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(statement), &t); err != nil {
+		return ClassOther
+	}
+	switch strings.ToUpper(t.Method) {
+	case "", "GET", "HEAD", "OPTIONS":
+		return ClassRead
+	}
+	return ClassWrite
+}
+
+func classifyMongo(statement string) string {
+	dec := json.NewDecoder(bytes.NewReader([]byte(statement)))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return ClassOther
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return ClassOther
+	}
+	op, _ := t.(string)
+	if schema.MongoReadCommands[op] {
+		return ClassRead
+	}
+	return ClassWrite
+}
+
+func classifyRedis(statement string) string {
+	f := strings.Fields(statement)
+	if len(f) == 0 {
+		return ClassOther
+	}
+	if schema.RedisReadCommands[strings.ToUpper(f[0])] {
+		return ClassRead
+	}
+	return ClassWrite
+}
+
+// splitStatements splits statement on semicolons outside of quotes and
+// comments, and strips the comments.
+func splitStatements(statement string) []string {
+	var out []string
+	var b strings.Builder
+	var quote rune
+	rs := []rune(statement)
+	flush := func() {
+		if s := strings.TrimFunc(b.String(), unicode.IsSpace); s != "" {
+			out = append(out, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+			b.WriteRune(' ')
+			continue
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == '/') {
+				i++
+			}
+			i++
+			b.WriteRune(' ')
+			continue
+		case r == ';':
+			flush()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    string
+		kind      string
+		statement string
+		want      []string
+	}{
+		{"select", "postgres", "", "SELECT * FROM users", []string{ClassRead}},
+		{"lower case", "mysql", "", "  select 1", []string{ClassRead}},
+		{"parenthesized", "postgres", "", "(SELECT 1) UNION (SELECT 2)", []string{ClassRead}},
+		{"insert", "postgres", "", "INSERT INTO users VALUES (1)", []string{ClassWrite}},
+		{"ddl", "postgres", "", "DROP TABLE users", []string{ClassDDL}},
+		{"exec", "mssql", "", "EXEC dbo.cleanup", []string{ClassCall}},
+		{"batch", "postgres", "", "SELECT 1; DELETE FROM users", []string{ClassRead, ClassWrite}},
+		{"same class batch", "postgres", "", "SELECT 1; SELECT 2;", []string{ClassRead}},
+		{"line comment", "postgres", "", "-- list users\nSELECT * FROM users", []string{ClassRead}},
+		{"line comment hides batch", "postgres", "", "SELECT 1 -- ; DROP TABLE users", []string{ClassRead}},
+		{"block comment before write", "postgres", "", "/* read */ DELETE FROM users", []string{ClassWrite}},
+		{"block comment between statements", "postgres", "", "SELECT 1;/* x */DROP TABLE users", []string{ClassRead, ClassDDL}},
+		{"semicolon in string", "postgres", "", "SELECT 'a; DROP TABLE users'", []string{ClassRead}},
+		{"read cte", "postgres", "", "WITH u AS (SELECT * FROM users) SELECT * FROM u", []string{ClassRead}},
+		{"writable cte", "postgres", "", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", []string{ClassWrite}},
+		{"writable cte update", "postgres", "", "with u as (update users set a = 1 returning id) select id from u", []string{ClassWrite}},
+		{"select into", "postgres", "", "SELECT * INTO backup FROM users", []string{ClassWrite}},
+		{"mysql select into outfile", "mysql", "", "SELECT * FROM users INTO OUTFILE '/tmp/u'", []string{ClassWrite}},
+		{"empty", "postgres", "", " ;-- nothing", []string{ClassOther}},
+		{"unknown keyword", "postgres", "", "VACUUM users", []string{ClassOther}},
+		{"call kind", "postgres", "call", "refresh", []string{ClassCall}},
+		{"bulk kind", "postgres", "bulk", "users", []string{ClassWrite}},
+		{"http get", "http", "", `{"method":"GET","path":"/users"}`, []string{ClassRead}},
+		{"http post", "http", "", `{"method":"post","path":"/users"}`, []string{ClassWrite}},
+		{"mongo find", "mongodb", "", `{"find":"users","filter":{}}`, []string{ClassRead}},
+		{"mongo delete", "mongodb", "", `{"delete":"users","deletes":[]}`, []string{ClassWrite}},
+		{"redis get", "redis", "", "get key", []string{ClassRead}},
+		{"redis del", "redis", "", "DEL key", []string{ClassWrite}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.driver, tt.kind, tt.statement); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Classify(%q) = %v, want %v", tt.statement, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		want      []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"trailing semicolon", "SELECT 1;", []string{"SELECT 1"}},
+		{"batch", "SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"quoted semicolons", `SELECT ';', ";", ` + "`;`", []string{`SELECT ';', ";", ` + "`;`"}},
+		{"line comment", "SELECT 1 -- ; SELECT 2\n; SELECT 3", []string{"SELECT 1", "SELECT 3"}},
+		{"block comment", "SELECT /* ; */ 1", []string{"SELECT   1"}},
+		{"unterminated block comment", "SELECT 1 /* ; SELECT 2", []string{"SELECT 1"}},
+		{"comment markers in string", "SELECT '--;/*'", []string{"SELECT '--;/*'"}},
+		{"empty", " ; ; ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.statement); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.statement, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rule effects.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var (
+	// ErrDenied is returned when a policy does not allow a sign request.
+	ErrDenied = errors.New("denied by policy")
+)
+
+// Duration is a time.Duration which is encoded in JSON as a string such as
+// "24h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule matches sign requests and allows or denies them. Empty match fields
+// match any request. Principals and connection params are glob patterns as
+// accepted by path.Match.
+type Rule struct {
+	Name             string            `json:"name"`
+	Effect           string            `json:"effect"`
+	Principals       []string          `json:"principals,omitempty"`
+	Drivers          []string          `json:"drivers,omitempty"`
+	Connection       map[string]string `json:"connection,omitempty"`
+	StatementClasses []string          `json:"statement_classes,omitempty"`
+	StatementPattern string            `json:"statement_pattern,omitempty"`
+	// MaxUses and MaxTTL limit the requests an allow rule signs. A request
+	// with unlimited uses or no expiry does not meet a limit.
+	MaxUses int      `json:"max_uses,omitempty"`
+	MaxTTL  Duration `json:"max_ttl,omitempty"`
+
+	statementRe *regexp.Regexp
+}
+
+// Config is a set of rules, which are evaluated in order.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (c *Config) validate() error {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		switch r.Effect {
+		case "":
+			r.Effect = EffectAllow
+		case EffectAllow, EffectDeny:
+		default:
+			return fmt.Errorf("%s: effect must be allow or deny", r.Name)
+		}
+		for _, p := range r.Principals {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("%s: principal %q: %w", r.Name, p, err)
+			}
+		}
+		for n, p := range r.Connection {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("%s: connection %s: %w", r.Name, n, err)
+			}
+		}
+		for _, sc := range r.StatementClasses {
+			switch sc {
+			case ClassRead, ClassWrite, ClassDDL, ClassCall, ClassOther:
+			default:
+				return fmt.Errorf("%s: statement class %q is invalid", r.Name, sc)
+			}
+		}
+		if r.StatementPattern != "" {
+			re, err := regexp.Compile(r.StatementPattern)
+			if err != nil {
+				return fmt.Errorf("%s: statement_pattern: %w", r.Name, err)
+			}
+			r.statementRe = re
+		}
+		if r.MaxUses < 0 {
+			return fmt.Errorf("%s: max_uses must be equal or greater than 0", r.Name)
+		}
+		if r.MaxTTL < 0 {
+			return fmt.Errorf("%s: max_ttl must be equal or greater than 0", r.Name)
+		}
+	}
+	return nil
+}
+
+func globAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(set []string, vs []string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, v := range vs {
+		found := false
+		for _, s := range set {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the rule applies to the request.
+func (r *Rule) matches(sr *schema.SignRequest, classes []string) bool {
+	if !globAny(r.Principals, sr.SignedBy) {
+		return false
+	}
+	if len(r.Drivers) > 0 && !containsAll(r.Drivers, []string{sr.Connection.Driver}) {
+		return false
+	}
+	for n, p := range r.Connection {
+		v, ok := sr.Connection.Params[n]
+		if !ok || v == nil {
+			return false
+		}
+		if ok, _ := path.Match(p, fmt.Sprint(v)); !ok {
+			return false
+		}
+	}
+	if !containsAll(r.StatementClasses, classes) {
+		return false
+	}
+	if r.statementRe != nil && !r.statementRe.MatchString(sr.Statement) {
+		return false
+	}
+	return true
+}
+
+// checkLimits returns an error if the request exceeds the rule's limits.
+func (r *Rule) checkLimits(sr *schema.SignRequest, now time.Time) error {
+	if r.MaxUses > 0 && (sr.MaxUses <= 0 || sr.MaxUses > r.MaxUses) {
+		return fmt.Errorf("%w: %s: max_uses must be between 1 and %d", ErrDenied, r.Name, r.MaxUses)
+	}
+	if r.MaxTTL > 0 {
+		ttl := time.Unix(sr.ExpiresAt, 0).Sub(now)
+		if sr.ExpiresAt <= 0 || ttl > time.Duration(r.MaxTTL) {
+			return fmt.Errorf("%w: %s: expires_at must be at most %s from now", ErrDenied, r.Name, time.Duration(r.MaxTTL))
+		}
+	}
+	return nil
+}
+
+// Evaluate returns nil if the config allows the request. The first rule
+// which matches the request decides: a deny rule denies it and an allow
+// rule allows it if it is within the rule's limits. Requests which match
+// no rule are denied.
+func (c *Config) Evaluate(sr *schema.SignRequest) error {
+	l := log.WithFields(log.Fields{
+		"app":       "policy",
+		"fn":        "Evaluate",
+		"principal": sr.SignedBy,
+	})
+	l.Debug("start")
+	classes := Classify(sr.Connection.Driver, string(sr.Kind), sr.Statement)
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if !r.matches(sr, classes) {
+			continue
+		}
+		l = l.WithField("rule", r.Name)
+		if r.Effect == EffectDeny {
+			l.Debug("denied")
+			return fmt.Errorf("%w: %s", ErrDenied, r.Name)
+		}
+		if err := r.checkLimits(sr, time.Now()); err != nil {
+			l.Debug(err)
+			return err
+		}
+		l.Debug("allowed")
+		return nil
+	}
+	return fmt.Errorf("%w: no rule allows %s statements on %s", ErrDenied, strings.Join(classes, "/"), sr.Connection.Driver)
+}
+
+// Engine evaluates requests against a config file, which is reloaded when
+// its modification time changes. If a changed file is invalid the previous
+// config is kept and an error is logged.
+type Engine struct {
+	Path string
+
+	mu      sync.RWMutex
+	config  *Config
+	modTime time.Time
+}
+
+// NewEngine loads the config file at path.
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{Path: path}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) load() error {
+	fi, err := os.Stat(e.Path)
+	if err != nil {
+		return err
+	}
+	e.mu.RLock()
+	unchanged := e.config != nil && fi.ModTime().Equal(e.modTime)
+	e.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	fd, err := os.ReadFile(e.Path)
+	if err != nil {
+		return err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(fd, c); err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.config = c
+	e.modTime = fi.ModTime()
+	e.mu.Unlock()
+	return nil
+}
+
+// Evaluate reloads the config file if it has changed and evaluates the
+// request against it.
+func (e *Engine) Evaluate(sr *schema.SignRequest) error {
+	l := log.WithFields(log.Fields{
+		"app":  "policy",
+		"fn":   "Engine.Evaluate",
+		"path": e.Path,
+	})
+	if err := e.load(); err != nil {
+		l.WithError(err).Error("failed to reload policy, keeping the previous policy")
+	}
+	e.mu.RLock()
+	c := e.config
+	e.mu.RUnlock()
+	return c.Evaluate(sr)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+// TrustedProxies are the networks of the proxies whose X-Forwarded-For
+// headers are trusted.
+var TrustedProxies []*net.IPNet
+
+// parseTrustedProxies parses a comma separated list of CIDRs and addresses.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		n, err := schema.ParseCIDROrIP(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func trusted(ip net.IP) bool {
+	for _, n := range TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client which made r. If the peer is
+// a trusted proxy, the X-Forwarded-For addresses are walked from the
+// nearest, and the first one which is not a trusted proxy is the client.
+// Addresses added by the client itself are never reached unless every
+// proxy in the chain is trusted.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// the chain can not be followed past an invalid address
+			return ip
+		}
+		ip = hop
+		if !trusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// loadTrustedProxies sets TrustedProxies from TRUSTED_PROXIES.
+func loadTrustedProxies() error {
+	nets, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	TrustedProxies = nets
+	return nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	TrustedProxies = proxies
+	defer func() { TrustedProxies = nil }()
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted peer with xff", "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed xff behind trusted proxy", "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"spoofed trusted address", "10.0.0.1:1234", []string{"10.9.9.9, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"198.51.100.1, 192.0.2.10, 10.0.0.2"}, "198.51.100.1"},
+		{"multiple headers", "10.0.0.1:1234", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"invalid hop", "10.0.0.1:1234", []string{"198.51.100.1, bogus"}, "10.0.0.1"},
+		{"invalid hop after trusted", "10.0.0.1:1234", []string{"bogus, 10.0.0.2"}, "10.0.0.2"},
+		{"every hop trusted", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"no xff", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"ipv6 peer", "[2001:db8::1]:1234", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/exec", nil)
+			r.RemoteAddr = tt.remote
+			for _, h := range tt.xff {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			if got := clientIP(r); got.String() != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.0/8,bogus"); err == nil {
+		t.Error("parseTrustedProxies() accepted an invalid address")
+	}
+	nets, err := parseTrustedProxies(" , 10.0.0.1,")
+	if err != nil || len(nets) != 1 || nets[0].String() != "10.0.0.1/32" {
+		t.Errorf("parseTrustedProxies() = %v, %v", nets, err)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/robertlestak/sigc/internal/auth"
+	"github.com/robertlestak/sigc/internal/freeze"
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// AdminAuthConfig authenticates the admins which manage freezes. The admin
+// endpoints are only served if it is set.
+var AdminAuthConfig *auth.Config
+
+// adminAuth wraps an admin handler, rejecting requests which do not
+// authenticate with AdminAuthConfig.
+func adminAuth(next func(http.ResponseWriter, *http.Request, *auth.Principal)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := log.WithFields(log.Fields{
+			"app": "server",
+			"fn":  "adminAuth",
+		})
+		p, err := AdminAuthConfig.Authenticate(r)
+		if err != nil {
+			l.Error(err)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next(w, r, p)
+	}
+}
+
+func HandleListFreezes(w http.ResponseWriter, r *http.Request, p *auth.Principal) {
+	l := log.WithFields(log.Fields{
+		"app":       "server",
+		"fn":        "HandleListFreezes",
+		"principal": p.String(),
+	})
+	l.Debug("start")
+	fs, err := freeze.List()
+	if err != nil {
+		l.Error(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fs)
+}
+
+func HandleSetFreeze(w http.ResponseWriter, r *http.Request, p *auth.Principal) {
+	l := log.WithFields(log.Fields{
+		"app":       "server",
+		"fn":        "HandleSetFreeze",
+		"principal": p.String(),
+	})
+	l.Debug("start")
+	defer r.Body.Close()
+	f := &freeze.Freeze{}
+	if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+		l.Error(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	f.CreatedBy = p.String()
+	if err := freeze.Set(f); err != nil {
+		l.Error(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	l.WithFields(log.Fields{
+		"scope":  f.Scope,
+		"value":  f.Value,
+		"reason": f.Reason,
+	}).Warn("freeze set")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+func HandleDeleteFreeze(w http.ResponseWriter, r *http.Request, p *auth.Principal) {
+	l := log.WithFields(log.Fields{
+		"app":       "server",
+		"fn":        "HandleDeleteFreeze",
+		"principal": p.String(),
+	})
+	l.Debug("start")
+	scope, value := r.URL.Query().Get("scope"), r.URL.Query().Get("value")
+	if err := freeze.Delete(scope, value); err != nil {
+		l.Error(err)
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	l.WithFields(log.Fields{
+		"scope": scope,
+		"value": value,
+	}).Warn("freeze deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFingerprint returns the fingerprint of a connection, which
+// connection freezes are set for.
+func HandleFingerprint(w http.ResponseWriter, r *http.Request, p *auth.Principal) {
+	l := log.WithFields(log.Fields{
+		"app":       "server",
+		"fn":        "HandleFingerprint",
+		"principal": p.String(),
+	})
+	l.Debug("start")
+	defer r.Body.Close()
+	c := &schema.Connection{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		l.Error(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"fingerprint": c.Fingerprint()})
+}
+
+// registerAdmin registers the admin endpoints.
+func registerAdmin() {
+	Router.HandleFunc("/admin/freezes", adminAuth(HandleListFreezes)).Methods(http.MethodGet)
+	Router.HandleFunc("/admin/freezes", adminAuth(HandleSetFreeze)).Methods(http.MethodPut)
+	Router.HandleFunc("/admin/freezes", adminAuth(HandleDeleteFreeze)).Methods(http.MethodDelete)
+	Router.HandleFunc("/admin/fingerprint", adminAuth(HandleFingerprint)).Methods(http.MethodPost)
+}
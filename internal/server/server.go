@@ -1,18 +1,83 @@
 package server
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/robertlestak/sigc/internal/auth"
+	"github.com/robertlestak/sigc/internal/freeze"
+	"github.com/robertlestak/sigc/internal/keys"
+	"github.com/robertlestak/sigc/internal/policy"
 	"github.com/robertlestak/sigc/pkg/client"
 	"github.com/robertlestak/sigc/pkg/schema"
 	"github.com/rs/cors"
 	log "github.com/sirupsen/logrus"
 )
 
-var Router *mux.Router
+var (
+	Router *mux.Router
+	// AuthConfig authenticates the principals which sign requests. If it is
+	// nil requests are only signed, anonymously, if AuthDisabled is set.
+	AuthConfig *auth.Config
+	// AuthDisabled allows requests to be signed without authentication.
+	AuthDisabled bool
+	// ExecAuthConfig verifies the credentials of the callers of /exec, which
+	// are matched against the binding of the requests they execute.
+	ExecAuthConfig *auth.Config
+	// Policy decides which principals may sign which requests. If it is nil
+	// every authenticated principal may sign any request.
+	Policy *policy.Engine
+)
+
+// writeError writes err as a JSON error body with the given status.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// writeRateLimitHeaders writes the status of a request's rate limits.
+func writeRateLimitHeaders(w http.ResponseWriter, st *keys.RateLimitStatus) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(st.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(st.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(st.Reset.Seconds())), 10))
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(st.RetryAfter.Seconds())), 10))
+	}
+}
+
+// Error codes, returned in the code field of error bodies for errors which
+// clients may need to tell apart.
+const (
+	ErrCodeAddressNotAllowed = "address_not_allowed"
+	ErrCodeOutsideWindow     = "outside_window"
+	ErrCodeRateLimited       = "rate_limited"
+	ErrCodeFrozen            = "frozen"
+	ErrCodeInFlight          = "idempotency_in_flight"
+	ErrCodeKeyReused         = "idempotency_key_reused"
+)
+
+// writeErrorCode writes err as a JSON error body with the given status and
+// error code.
+func writeErrorCode(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "code": code})
+}
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	l := log.WithFields(log.Fields{
@@ -23,6 +88,71 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// envInt returns the integer value of the environment variable name, or
+// def if it is not set or invalid.
+func envInt(name string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// rowsFormat returns the bulk row format for a part's content type.
+func rowsFormat(contentType string) (string, error) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("rows content type %q is invalid", contentType)
+	}
+	switch mt {
+	case "application/json":
+		return schema.RowsJSON, nil
+	case "application/x-ndjson", "application/jsonl":
+		return schema.RowsNDJSON, nil
+	case "text/csv":
+		return schema.RowsCSV, nil
+	}
+	return "", fmt.Errorf("rows content type %s is not supported", mt)
+}
+
+// readBulkRequest reads a multipart bulk request, made of the signed
+// request in the request part and the rows to insert in the rows part.
+// The size of the body is limited by BULK_MAX_BYTES and the number of rows
+// by BULK_MAX_ROWS. The raw rows part is written to h.
+func readBulkRequest(w http.ResponseWriter, r *http.Request, sr *schema.SignedRequest, h io.Writer) error {
+	r.Body = http.MaxBytesReader(w, r.Body, envInt("BULK_MAX_BYTES", 64<<20))
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch part.FormName() {
+		case "request":
+			if err := json.NewDecoder(part).Decode(sr); err != nil {
+				return err
+			}
+		case "rows":
+			format, err := rowsFormat(part.Header.Get("Content-Type"))
+			if err != nil {
+				return err
+			}
+			header := r.URL.Query().Get("header") == "true"
+			rows, err := schema.ParseRows(io.TeeReader(part, h), format, header, int(envInt("BULK_MAX_ROWS", 100000)))
+			if err != nil {
+				return err
+			}
+			sr.Rows = rows
+		}
+		part.Close()
+	}
+}
+
 func HandleExec(w http.ResponseWriter, r *http.Request) {
 	l := log.WithFields(log.Fields{
 		"app": "server",
@@ -31,18 +161,102 @@ func HandleExec(w http.ResponseWriter, r *http.Request) {
 	l.Debug("start")
 	defer r.Body.Close()
 	sr := &schema.SignedRequest{}
-	err := json.NewDecoder(r.Body).Decode(sr)
+	// params_hash of a proof is the hash of the params exactly as sent: the
+	// raw params value, or the raw rows part of a bulk request
+	ph := sha256.New()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := readBulkRequest(w, r, sr, ph); err != nil {
+			l.Error(err)
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		var raw struct {
+			Params json.RawMessage `json:"params"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(body, sr)
+		}
+		if err == nil {
+			err = json.Unmarshal(body, &raw)
+		}
+		if err != nil {
+			l.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ph.Write(raw.Params)
+	}
+	caller, err := ExecAuthConfig.Caller(r)
 	if err != nil {
 		l.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusUnauthorized, err)
 		return
 	}
-	res, err := client.ExecSignedRequest(sr)
-	if err != nil {
+	caller.IP = clientIP(r)
+	caller.Proof = r.Header.Get("DPoP")
+	caller.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if len(caller.IdempotencyKey) > keys.MaxIdempotencyKeyLength {
+		err := fmt.Errorf("Idempotency-Key must be at most %d characters", keys.MaxIdempotencyKeyLength)
+		l.Error(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	caller.ParamsHash = base64.RawURLEncoding.EncodeToString(ph.Sum(nil))
+	res, err := client.ExecSignedRequest(sr, caller)
+	var rlErr *schema.RateLimitError
+	var frozenErr *freeze.FrozenError
+	if errors.Is(err, keys.ErrIdempotencyInFlight) {
+		l.Error(err)
+		writeErrorCode(w, http.StatusConflict, ErrCodeInFlight, err)
+		return
+	} else if errors.Is(err, keys.ErrIdempotencyMismatch) {
+		l.Error(err)
+		writeErrorCode(w, http.StatusUnprocessableEntity, ErrCodeKeyReused, err)
+		return
+	} else if errors.As(err, &frozenErr) {
+		l.Error(err)
+		if ra := frozenErr.RetryAfter(time.Now()); ra > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(ra.Seconds())), 10))
+		}
+		writeErrorCode(w, http.StatusServiceUnavailable, ErrCodeFrozen, err)
+		return
+	} else if errors.As(err, &rlErr) {
+		l.Error(err)
+		writeRateLimitHeaders(w, rlErr.Status)
+		writeErrorCode(w, http.StatusTooManyRequests, ErrCodeRateLimited, err)
+		return
+	} else if errors.Is(err, schema.ErrAddressNotAllowed) {
+		l.WithField("ip", caller.IP.String()).Error(err)
+		writeErrorCode(w, http.StatusForbidden, ErrCodeAddressNotAllowed, err)
+		return
+	} else if errors.Is(err, schema.ErrOutsideWindow) {
+		l.Error(err)
+		writeErrorCode(w, http.StatusForbidden, ErrCodeOutsideWindow, err)
+		return
+	} else if errors.Is(err, schema.ErrCallerNotBound) {
+		l.Error(err)
+		writeError(w, http.StatusForbidden, err)
+		return
+	} else if errors.Is(err, auth.ErrInvalidProof) {
+		l.Error(err)
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	} else if err != nil {
 		l.Error(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if res.Replay != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.Write(res.Replay)
+		return
+	}
+	if res.RateLimit != nil {
+		writeRateLimitHeaders(w, res.RateLimit)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		l.Error(err)
@@ -51,6 +265,18 @@ func HandleExec(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// signResponse is the response to /sign. The probe describes the data
+// source, so it is returned to the signer next to the signed request rather
+// than in it, and is not passed on to clients with the signed request.
+type signResponse struct {
+	*schema.SignedRequest
+	Probe *schema.Probe `json:"probe,omitempty"`
+}
+
+// createSignedRequest signs a sign request. It is replaced in tests, as
+// signing stores the key in redis.
+var createSignedRequest = (*schema.SignRequest).CreateSignedRequest
+
 func HandleCreateSignedRequest(w http.ResponseWriter, r *http.Request) {
 	l := log.WithFields(log.Fields{
 		"app": "server",
@@ -58,6 +284,22 @@ func HandleCreateSignedRequest(w http.ResponseWriter, r *http.Request) {
 	})
 	l.Debug("start")
 	defer r.Body.Close()
+	principal := &auth.Principal{Type: auth.PrincipalAnonymous}
+	if AuthConfig != nil {
+		p, err := AuthConfig.Authenticate(r)
+		if err != nil {
+			l.Error(err)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		principal = p
+	} else if !AuthDisabled {
+		err := errors.New("sign authentication is not configured")
+		l.Error(err)
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	l = l.WithField("principal", principal.String())
 	sr := &schema.SignRequest{}
 	err := json.NewDecoder(r.Body).Decode(sr)
 	if err != nil {
@@ -65,20 +307,46 @@ func HandleCreateSignedRequest(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	sr.SignedBy = principal.String()
 	err = sr.Validate()
 	if err != nil {
 		l.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	signedRequest, err := sr.CreateSignedRequest()
+	if Policy != nil {
+		if err := Policy.Evaluate(sr); err != nil {
+			l.Error(err)
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+	var probe *schema.Probe
+	if sr.ValidateConnection {
+		probe, err = client.Probe(sr)
+		if err != nil {
+			l.Error(err)
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	signedRequest, err := createSignedRequest(sr)
 	if err != nil {
 		l.Error(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	fields := log.Fields{
+		"key_id":     signedRequest.KeyID,
+		"connection": sr.Connection.Fingerprint(),
+	}
+	if probe != nil {
+		fields["probe_param_count"] = probe.ParamCount
+		fields["probe_param_types"] = probe.ParamTypes
+	}
+	l.WithFields(fields).Info("signed request")
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(signedRequest); err != nil {
+	if err := json.NewEncoder(w).Encode(&signResponse{signedRequest, probe}); err != nil {
 		l.Error(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -101,7 +369,42 @@ func StartServer(port string, corsList []string) error {
 		Debug:            os.Getenv("CORS_DEBUG") == "true",
 	})
 	h := c.Handler(Router)
-	return http.ListenAndServe(":"+port, h)
+	cert, key := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	if cert == "" && key == "" {
+		return http.ListenAndServe(":"+port, h)
+	}
+	tc, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Addr:      ":" + port,
+		Handler:   h,
+		TLSConfig: tc,
+	}
+	return srv.ListenAndServeTLS(cert, key)
+}
+
+// tlsConfig returns the server's TLS config. If TLS_CLIENT_CA is set client
+// certificates signed by it are verified, so that they can be used to
+// authenticate signers.
+func tlsConfig() (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	ca := os.Getenv("TLS_CLIENT_CA")
+	if ca == "" {
+		return tc, nil
+	}
+	pem, err := os.ReadFile(ca)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("TLS_CLIENT_CA has no certificates")
+	}
+	tc.ClientCAs = pool
+	tc.ClientAuth = tls.VerifyClientCertIfGiven
+	return tc, nil
 }
 
 func Server(port string) error {
@@ -111,8 +414,45 @@ func Server(port string) error {
 	})
 	l.Debug("start")
 	if os.Getenv("SIGN_SERVER") == "true" {
+		if path := os.Getenv("SIGN_AUTH_CONFIG"); path != "" {
+			c, err := auth.LoadConfig(path)
+			if err != nil {
+				return fmt.Errorf("SIGN_AUTH_CONFIG: %w", err)
+			}
+			AuthConfig = c
+		} else if os.Getenv("SIGN_AUTH_DISABLED") == "true" {
+			AuthDisabled = true
+			l.Warn("SIGN_AUTH_DISABLED is set, requests are signed without authentication")
+		} else {
+			return errors.New("SIGN_AUTH_CONFIG is required, set SIGN_AUTH_DISABLED=true to sign requests without authentication")
+		}
+		if path := os.Getenv("SIGN_POLICY_CONFIG"); path != "" {
+			e, err := policy.NewEngine(path)
+			if err != nil {
+				return fmt.Errorf("SIGN_POLICY_CONFIG: %w", err)
+			}
+			Policy = e
+		}
 		Router.HandleFunc("/sign", HandleCreateSignedRequest)
 	}
+	if err := loadTrustedProxies(); err != nil {
+		return err
+	}
+	if path := os.Getenv("EXEC_AUTH_CONFIG"); path != "" {
+		c, err := auth.LoadConfig(path)
+		if err != nil {
+			return fmt.Errorf("EXEC_AUTH_CONFIG: %w", err)
+		}
+		ExecAuthConfig = c
+	}
+	if path := os.Getenv("ADMIN_AUTH_CONFIG"); path != "" {
+		c, err := auth.LoadConfig(path)
+		if err != nil {
+			return fmt.Errorf("ADMIN_AUTH_CONFIG: %w", err)
+		}
+		AdminAuthConfig = c
+		registerAdmin()
+	}
 	Router.HandleFunc("/exec", HandleExec)
 	Router.HandleFunc("/health", healthHandler)
 	if port == "" {
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+)
+
+func TestHandleCreateSignedRequestProbe(t *testing.T) {
+	AuthDisabled = true
+	defer func() { AuthDisabled = false }()
+	createSignedRequest = func(r *schema.SignRequest) (*schema.SignedRequest, error) {
+		sig := "sealed"
+		return &schema.SignedRequest{Statement: r.Statement, ParamCount: r.ParamCount, KeyID: "kid", Signature: &sig}, nil
+	}
+	defer func() { createSignedRequest = (*schema.SignRequest).CreateSignedRequest }()
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantProbe  *schema.Probe
+	}{
+		{
+			name:       "validated",
+			body:       `{"private_key": "a2V5", "statement": "SELECT ? + ?", "param_count": 2, "validate_connection": true, "connection": {"driver": "sqlite", "params": {"path": ":memory:"}}}`,
+			wantStatus: http.StatusOK,
+			wantProbe:  &schema.Probe{ParamCount: 2},
+		},
+		{
+			name:       "not validated",
+			body:       `{"private_key": "a2V5", "statement": "SELECT ?", "param_count": 1, "connection": {"driver": "sqlite", "params": {"path": ":memory:"}}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "param count mismatch",
+			body:       `{"private_key": "a2V5", "statement": "SELECT ?", "param_count": 2, "validate_connection": true, "connection": {"driver": "sqlite", "params": {"path": ":memory:"}}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HandleCreateSignedRequest(w, httptest.NewRequest("POST", "/sign", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var res struct {
+				schema.SignedRequest
+				Probe *schema.Probe `json:"probe"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.KeyID != "kid" || res.Signature == nil || *res.Signature != "sealed" {
+				t.Errorf("signed request = %s", w.Body)
+			}
+			if (res.Probe == nil) != (tt.wantProbe == nil) {
+				t.Fatalf("probe = %v, want %v", res.Probe, tt.wantProbe)
+			}
+			if res.Probe != nil && res.Probe.ParamCount != tt.wantProbe.ParamCount {
+				t.Errorf("probe param_count = %d, want %d", res.Probe.ParamCount, tt.wantProbe.ParamCount)
+			}
+		})
+	}
+}
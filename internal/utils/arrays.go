@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// IsScalar reports whether v is a string, number, bool or null.
+func IsScalar(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// IsScalarArray reports whether v is an array of scalars.
+func IsScalarArray(v any) bool {
+	a, ok := v.([]any)
+	if !ok {
+		return false
+	}
+	for _, e := range a {
+		if !IsScalar(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// ArrayElemType returns the element type of an array<T> param type.
+func ArrayElemType(t string) (string, bool) {
+	if !strings.HasPrefix(t, "array<") || !strings.HasSuffix(t, ">") {
+		return "", false
+	}
+	return t[len("array<") : len(t)-1], true
+}
+
+// ArrayValues converts the client value of an array<elem> param into a
+// slice of values of the element type. JSON numbers are converted to int64
+// for int arrays.
+func ArrayValues(v any, elem string) ([]any, error) {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be an array")
+	}
+	out := make([]any, len(arr))
+	for i, e := range arr {
+		switch elem {
+		case "int":
+			f, ok := e.(float64)
+			if !ok || f != math.Trunc(f) {
+				return nil, fmt.Errorf("element %d must be an integer", i)
+			}
+			out[i] = int64(f)
+		case "float":
+			f, ok := e.(float64)
+			if !ok {
+				return nil, fmt.Errorf("element %d must be a number", i)
+			}
+			out[i] = f
+		case "string":
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("element %d must be a string", i)
+			}
+			out[i] = s
+		case "bool":
+			b, ok := e.(bool)
+			if !ok {
+				return nil, fmt.Errorf("element %d must be a boolean", i)
+			}
+			out[i] = b
+		default:
+			return nil, fmt.Errorf("array element type %s is not supported", elem)
+		}
+	}
+	return out, nil
+}
+
+// TypedArray converts array values into a slice of the element type, for
+// drivers which bind arrays natively.
+func TypedArray(vals []any, elem string) any {
+	switch elem {
+	case "int":
+		out := make([]int64, len(vals))
+		for i, v := range vals {
+			out[i] = v.(int64)
+		}
+		return out
+	case "float":
+		out := make([]float64, len(vals))
+		for i, v := range vals {
+			out[i] = v.(float64)
+		}
+		return out
+	case "string":
+		out := make([]string, len(vals))
+		for i, v := range vals {
+			out[i] = v.(string)
+		}
+		return out
+	case "bool":
+		out := make([]bool, len(vals))
+		for i, v := range vals {
+			out[i] = v.(bool)
+		}
+		return out
+	}
+	return vals
+}
+
+// NativeArrays returns params with the values of array params converted
+// into typed slices, for drivers which bind lists natively.
+func NativeArrays(params []any, types []string) ([]any, error) {
+	if len(types) == 0 {
+		return params, nil
+	}
+	out := make([]any, len(params))
+	copy(out, params)
+	for i, t := range types {
+		elem, ok := ArrayElemType(t)
+		if !ok || i >= len(params) {
+			continue
+		}
+		vals, err := ArrayValues(params[i], elem)
+		if err != nil {
+			return nil, fmt.Errorf("params[%d] %w", i, err)
+		}
+		out[i] = TypedArray(vals, elem)
+	}
+	return out, nil
+}
+
+// ExpandArrays rewrites the placeholders of array params in statement into
+// one placeholder per element, and returns the statement with the params
+// flattened to match. An empty array is replaced by NULL, so IN ($1)
+// matches nothing. Statements using $N placeholders are renumbered;
+// otherwise each ? placeholder takes the next param. Placeholders in quoted
+// strings and identifiers are left as is.
+func ExpandArrays(statement string, params []any, types []string) (string, []any, error) {
+	arrays := map[int][]any{}
+	for i, t := range types {
+		elem, ok := ArrayElemType(t)
+		if !ok || i >= len(params) {
+			continue
+		}
+		vals, err := ArrayValues(params[i], elem)
+		if err != nil {
+			return "", nil, fmt.Errorf("params[%d] %w", i, err)
+		}
+		arrays[i] = vals
+	}
+	if len(arrays) == 0 {
+		return statement, params, nil
+	}
+	dollar := MaxPlaceholder(statement) > 0
+	var b strings.Builder
+	var out []any
+	// numbered holds the new placeholders of each param for $N statements
+	numbered := map[int]string{}
+	placeholders := func(i int) string {
+		vals, ok := arrays[i]
+		if !ok {
+			out = append(out, params[i])
+			if dollar {
+				return "$" + strconv.Itoa(len(out))
+			}
+			return "?"
+		}
+		if len(vals) == 0 {
+			return "NULL"
+		}
+		ph := make([]string, len(vals))
+		for j, v := range vals {
+			out = append(out, v)
+			ph[j] = "?"
+			if dollar {
+				ph[j] = "$" + strconv.Itoa(len(out))
+			}
+		}
+		return strings.Join(ph, ", ")
+	}
+	rs := []rune(statement)
+	var quote rune
+	next := 0
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case dollar && r == '$' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(string(rs[i+1 : j]))
+			if n < 1 || n > len(params) {
+				return "", nil, fmt.Errorf("placeholder $%d has no matching param", n)
+			}
+			ph, ok := numbered[n-1]
+			if !ok {
+				ph = placeholders(n - 1)
+				numbered[n-1] = ph
+			}
+			b.WriteString(ph)
+			i = j - 1
+			continue
+		case !dollar && r == '?':
+			if next >= len(params) {
+				return "", nil, fmt.Errorf("placeholder %d has no matching param", next+1)
+			}
+			b.WriteString(placeholders(next))
+			next++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), out, nil
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// ClockSkew returns the clock skew tolerated by time checks, from
+// CLOCK_SKEW. It defaults to 0.
+func ClockSkew() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CLOCK_SKEW")); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
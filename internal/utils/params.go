@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StringParam returns the named connection param as a string. A missing
+// param returns an empty string.
+func StringParam(params map[string]any, name string) (string, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+}
+
+// IntParam returns the named connection param as an int. Both JSON numbers
+// and numeric strings are accepted. A missing param returns 0.
+func IntParam(params map[string]any, name string) (int, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("%s must be an integer", name)
+		}
+		return int(v), nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer", name)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+}
+
+// BoolParam returns the named connection param as a bool. Both JSON booleans
+// and strings accepted by strconv.ParseBool are accepted. A missing param
+// returns false.
+func BoolParam(params map[string]any, name string) (bool, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("%s must be a boolean", name)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("%s must be a boolean", name)
+	}
+}
+
+// StringSliceParam returns the named connection param as a string slice.
+// Both JSON arrays of strings and comma-separated strings are accepted. A
+// missing param returns nil.
+func StringSliceParam(params map[string]any, name string) ([]string, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		var ss []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ss = append(ss, s)
+			}
+		}
+		return ss, nil
+	case []string:
+		return v, nil
+	case []any:
+		ss := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings", name)
+			}
+			ss[i] = s
+		}
+		return ss, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+}
+
+// DurationParam returns the named connection param as a duration. Both
+// duration strings such as "10s" and JSON numbers of seconds are accepted.
+// A missing param returns 0.
+func DurationParam(params map[string]any, name string) (time.Duration, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, nil
+		}
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a duration", name)
+		}
+		return time.Duration(s * float64(time.Second)), nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	default:
+		return 0, fmt.Errorf("%s must be a duration", name)
+	}
+}
+
+// PortParam returns the named connection param as a TCP port. Both JSON
+// numbers and numeric strings are accepted.
+func PortParam(params map[string]any, name string) (string, error) {
+	p, err := IntParam(params, name)
+	if err != nil {
+		return "", err
+	}
+	if p < 1 || p > 65535 {
+		return "", fmt.Errorf("%s must be between 1 and 65535", name)
+	}
+	return strconv.Itoa(p), nil
+}
+
+// StringMapParam returns the named connection param as a map of strings. A
+// missing param returns nil.
+func StringMapParam(params map[string]any, name string) (map[string]string, error) {
+	switch v := params[name].(type) {
+	case nil:
+		return nil, nil
+	case map[string]string:
+		return v, nil
+	case map[string]any:
+		m := make(map[string]string, len(v))
+		for k, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a map of strings", name)
+			}
+			m[k] = s
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%s must be a map of strings", name)
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+)
+
+// placeholderRe matches a positional $N placeholder.
+var placeholderRe = regexp.MustCompile(`\$([0-9]+)`)
+
+// NumInput prepares statement on a connection from db without executing it
+// and returns the number of placeholders the driver reports, or -1 if the
+// driver cannot tell.
+func NumInput(db *sql.DB, statement string) (int, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	n := -1
+	err = conn.Raw(func(dc any) error {
+		stmt, err := dc.(driver.Conn).Prepare(statement)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		n = stmt.NumInput()
+		return nil
+	})
+	return n, err
+}
+
+// MaxPlaceholder returns the highest $N placeholder in s, or 0 if s has no
+// placeholders.
+func MaxPlaceholder(s string) int {
+	max := 0
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > max {
+			max = n
+		}
+	}
+	return max
+}
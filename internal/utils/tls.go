@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsPEM reports whether v is inline PEM data rather than a file path.
+func IsPEM(v string) bool {
+	return strings.Contains(v, "-----BEGIN ")
+}
+
+// LoadPEM returns the PEM data in v, reading it from the file v names if v
+// is not inline PEM data.
+func LoadPEM(v string) ([]byte, error) {
+	if IsPEM(v) {
+		return []byte(v), nil
+	}
+	return os.ReadFile(v)
+}
+
+// TLSConfig creates a client TLS config from a CA certificate and an
+// optional client certificate and key, each of which is either a file path
+// or inline PEM data. An empty ca uses the system roots.
+func TLSConfig(ca, cert, key string, skipVerify bool) (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+	if ca != "" {
+		pem, err := LoadPEM(ca)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA")
+		}
+	}
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		certPEM, err := LoadPEM(cert)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := LoadPEM(key)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+	return c, nil
+}
+
+// PEMFiles writes inline PEM data to files in a private temporary
+// directory, for drivers which only accept certificate and key paths.
+type PEMFiles struct {
+	dir string
+}
+
+// Path returns a file path for the PEM data or file path in v. Inline PEM
+// data is written to a file named name, readable only by the current user.
+func (p *PEMFiles) Path(name, v string) (string, error) {
+	if !IsPEM(v) {
+		return v, nil
+	}
+	if p.dir == "" {
+		dir, err := os.MkdirTemp("", "sigc-pem-")
+		if err != nil {
+			return "", err
+		}
+		p.dir = dir
+	}
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, []byte(v), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Remove deletes any files written by Path.
+func (p *PEMFiles) Remove() error {
+	if p.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(p.dir)
+	p.dir = ""
+	return err
+}
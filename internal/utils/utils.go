@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 
 	log "github.com/sirupsen/logrus"
@@ -34,6 +35,10 @@ func RowsToMap(rows *sql.Rows) (map[string]any, error) {
 			l.Debugf("%s: %s", colName, *val)
 		}
 	}
+	if err := rows.Err(); err != nil {
+		l.Error(err)
+		return nil, err
+	}
 	l.Debug("Converted row to map")
 	return m, nil
 }
@@ -68,6 +73,58 @@ func RowsToMapSlice(rows *sql.Rows) ([]map[string]any, error) {
 		}
 		sm = append(sm, m)
 	}
+	if err := rows.Err(); err != nil {
+		l.Error(err)
+		return nil, err
+	}
 	l.Debug("Converted row to map")
 	return sm, nil
 }
+
+// Querier is implemented by *sql.Conn and *sql.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// WithConn runs fn on a single connection from db. If tx is set fn runs in
+// a transaction, which is committed if fn succeeds and rolled back
+// otherwise.
+func WithConn(db *sql.DB, tx bool, fn func(Querier) error) error {
+	ctx := context.Background()
+	if !tx {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return fn(c)
+	}
+	t, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(t); err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+// Query runs statement on db and maps the returned rows with fn. If tx is
+// set the statement runs in a transaction, which is committed once the rows
+// have been read and rolled back on any error.
+func Query(db *sql.DB, tx bool, statement string, params []any, fn func(*sql.Rows) ([]map[string]any, error)) ([]map[string]any, error) {
+	var m []map[string]any
+	err := WithConn(db, tx, func(q Querier) error {
+		rows, err := q.QueryContext(context.Background(), statement, params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		m, err = fn(rows)
+		return err
+	})
+	return m, err
+}
@@ -3,8 +3,14 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"time"
 
+	"github.com/robertlestak/sigc/internal/auth"
+	"github.com/robertlestak/sigc/internal/freeze"
 	"github.com/robertlestak/sigc/internal/keys"
+	"github.com/robertlestak/sigc/internal/utils"
 	"github.com/robertlestak/sigc/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
@@ -15,6 +21,23 @@ type Client interface {
 	Disconnect() error
 }
 
+// Preparer is implemented by drivers which can check a statement against
+// the data source without executing it.
+type Preparer interface {
+	Prepare(statement string) (*schema.Probe, error)
+}
+
+// Caller is implemented by drivers which can call stored procedures.
+type Caller interface {
+	Call(*schema.Request) *schema.Response
+}
+
+// BulkInserter is implemented by drivers which can insert many rows in a
+// single operation.
+type BulkInserter interface {
+	BulkInsert(*schema.Request) *schema.Response
+}
+
 func MarshalResponse(r *schema.Response) ([]byte, error) {
 	return json.Marshal(r)
 }
@@ -25,22 +48,123 @@ func Exec(r *schema.SignRequest) (*schema.Response, error) {
 		"fn":  "SignRequest.Exec",
 	})
 	l.Debug("start")
+	l.WithFields(log.Fields{
+		"driver": r.Connection.Driver,
+		"params": r.Connection.RedactedParams(),
+	}).Debug("connecting")
 	d := GetDriver(DriverName(r.Connection.Driver))
 	if d == nil {
 		return nil, errors.New("invalid driver")
 	}
+	exec := d.Exec
+	switch r.Kind {
+	case schema.KindCall:
+		c, ok := d.(Caller)
+		if !ok {
+			return nil, fmt.Errorf("driver %s can not call procedures", r.Connection.Driver)
+		}
+		exec = c.Call
+	case schema.KindBulk:
+		b, ok := d.(BulkInserter)
+		if !ok {
+			return nil, fmt.Errorf("driver %s can not bulk insert", r.Connection.Driver)
+		}
+		exec = b.BulkInsert
+	}
 	err := d.Connect(r.Connection.Params)
 	if err != nil {
 		return nil, err
 	}
 	defer d.Disconnect()
-	return d.Exec(&schema.Request{
-		Statement: r.Statement,
-		Params:    r.Params,
-	}), nil
+	return execWithRetry(d, exec, &schema.Request{
+		Statement:  r.Statement,
+		Params:     r.Params,
+		Options:    r.Options,
+		Kind:       r.Kind,
+		ProcParams: r.ProcParams,
+		Columns:    r.Columns,
+		Rows:       r.Rows,
+		ParamTypes: r.ParamTypes,
+	}, RetryPolicyFromEnv()), nil
 }
 
-func ExecSignedRequest(sr *schema.SignedRequest) (*schema.Response, error) {
+// Probe connects to the data source of a sign request and, if the driver
+// supports it, prepares the statement to check its syntax and that it takes
+// param_count params.
+func Probe(r *schema.SignRequest) (*schema.Probe, error) {
+	l := log.WithFields(log.Fields{
+		"app": "client",
+		"fn":  "Probe",
+	})
+	l.Debug("start")
+	d := GetDriver(DriverName(r.Connection.Driver))
+	if d == nil {
+		return nil, errors.New("invalid driver")
+	}
+	if err := d.Connect(r.Connection.Params); err != nil {
+		return nil, err
+	}
+	defer d.Disconnect()
+	p, ok := d.(Preparer)
+	if !ok || (r.Kind != "" && r.Kind != schema.KindStatement) {
+		l.Debug("statement can not be prepared")
+		return &schema.Probe{ParamCount: -1}, nil
+	}
+	pr, err := p.Prepare(r.Statement)
+	if err != nil {
+		return nil, err
+	}
+	if pr.ParamCount >= 0 && pr.ParamCount != r.ParamCount {
+		return pr, fmt.Errorf("statement takes %d params, param_count is %d", pr.ParamCount, r.ParamCount)
+	}
+	return pr, nil
+}
+
+// proofWindowFromEnv returns how far from now the iat of a proof of
+// possession may be, from PROOF_WINDOW. It defaults to 5 minutes.
+func proofWindowFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PROOF_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// proofWindow returns the proof window widened by the clock skew.
+func proofWindow() time.Duration {
+	return proofWindowFromEnv() + utils.ClockSkew()
+}
+
+// verifyProof verifies the caller's proof of possession of the client key
+// and returns its nonce, which is consumed by useNonce once every other
+// check of the request has passed, so that a rejected request does not
+// burn the nonce.
+func verifyProof(keyID, thumbprint string, caller *schema.Caller) (string, error) {
+	if caller == nil {
+		caller = &schema.Caller{}
+	}
+	claims, err := auth.VerifyProof(caller.Proof, thumbprint, keyID, caller.ParamsHash, proofWindow(), time.Now())
+	if err != nil {
+		return "", err
+	}
+	return claims.Nonce, nil
+}
+
+// useNonce consumes the nonce of a proof, if there is one. Nonces are kept
+// for twice the widened proof window, so a proof can not be replayed while
+// its iat is accepted.
+func useNonce(keyID, nonce string) error {
+	if nonce == "" {
+		return nil
+	}
+	if err := keys.UseNonce(keyID, nonce, 2*proofWindow()); err != nil {
+		return fmt.Errorf("%w: %v", auth.ErrInvalidProof, err)
+	}
+	return nil
+}
+
+// ExecSignedRequest validates and executes a signed request on behalf of
+// caller, which must match the request's binding if it has one.
+func ExecSignedRequest(sr *schema.SignedRequest, caller *schema.Caller) (*schema.Response, error) {
 	l := log.WithFields(log.Fields{
 		"app": "schema",
 		"fn":  "SignedRequest.Exec",
@@ -60,14 +184,140 @@ func ExecSignedRequest(sr *schema.SignedRequest) (*schema.Response, error) {
 		l.Error(err)
 		return nil, err
 	}
-	if err := keys.UseKeyID(sr.KeyID); err != nil {
+	if err := freeze.Check(req.Connection.Driver, req.Connection.Fingerprint(), req.SignedBy); err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	if err := req.AddrAllowed(caller); err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	if err := req.BindTo.Allows(caller); err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	var nonce string
+	if req.ClientKey != "" {
+		if nonce, err = verifyProof(sr.KeyID, req.ClientKey, caller); err != nil {
+			l.Error(err)
+			return nil, err
+		}
+	}
+	if caller != nil && caller.IdempotencyKey != "" {
+		return execIdempotent(sr.KeyID, req, caller, nonce)
+	}
+	return execOnce(sr.KeyID, req, nonce)
+}
+
+// execOnce consumes a use of the signed request within its rate limits,
+// and the nonce of its proof, and executes it. It only returns an error if
+// the request was not executed.
+func execOnce(keyID string, req *schema.SignRequest, nonce string) (*schema.Response, error) {
+	l := log.WithFields(log.Fields{
+		"app": "client",
+		"fn":  "execOnce",
+		"kid": keyID,
+	})
+	l.Debug("start")
+	limits, err := req.KeyRateLimits()
+	if err != nil {
 		l.Error(err)
 		return nil, err
 	}
+	rl, err := keys.UseRateLimits(keyID, limits)
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	if !rl.Allowed {
+		err := &schema.RateLimitError{Status: rl}
+		l.Error(err)
+		return nil, err
+	}
+	// the use recorded against the rate limits is released if the request
+	// is refused before it is executed
+	err = useNonce(keyID, nonce)
+	if err == nil {
+		err = keys.UseKeyID(keyID)
+	}
+	if err != nil {
+		l.Error(err)
+		if rerr := keys.ReleaseRateLimits(keyID, limits, rl); rerr != nil {
+			l.Error(rerr)
+		}
+		return nil, err
+	}
 	res, err := Exec(req)
 	if err != nil {
 		l.Error(err)
 		return nil, err
 	}
+	if len(limits) > 0 {
+		res.RateLimit = rl
+	}
+	return res, nil
+}
+
+// idempotencyTTLFromEnv returns how long the responses of requests with an
+// idempotency key are kept, from IDEMPOTENCY_TTL. It defaults to 24 hours.
+func idempotencyTTLFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyLeaseFromEnv returns how long an execution with an idempotency
+// key is held as in progress, from IDEMPOTENCY_LEASE. It defaults to 10
+// minutes.
+func idempotencyLeaseFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_LEASE")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// execIdempotent executes the signed request at most once for the caller's
+// idempotency key. Later executions with the key return the stored response
+// of the first in Replay, without consuming a use or the nonce. If the
+// request is not executed, or its statement fails, the key is released, so
+// that it can be retried.
+func execIdempotent(keyID string, req *schema.SignRequest, caller *schema.Caller, nonce string) (*schema.Response, error) {
+	l := log.WithFields(log.Fields{
+		"app": "client",
+		"fn":  "execIdempotent",
+		"kid": keyID,
+	})
+	l.Debug("start")
+	prev, err := keys.BeginIdempotent(keyID, caller.IdempotencyKey, caller.ParamsHash, idempotencyLeaseFromEnv())
+	if err != nil {
+		l.Error(err)
+		return nil, err
+	}
+	if prev != nil {
+		l.Debug("replaying response")
+		return &schema.Response{Replay: prev.Response}, nil
+	}
+	res, err := execOnce(keyID, req, nonce)
+	if err != nil || res.Error != nil {
+		// failed statements are released rather than stored, as their
+		// error is not encoded in the response
+		if rerr := keys.ReleaseIdempotent(keyID, caller.IdempotencyKey); rerr != nil {
+			l.Error(rerr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	// the request has been executed, so the key stays pending until its
+	// lease ends if the response can not be stored
+	b, err := MarshalResponse(res)
+	if err == nil {
+		err = keys.CompleteIdempotent(keyID, caller.IdempotencyKey, caller.ParamsHash, b, idempotencyTTLFromEnv())
+	}
+	if err != nil {
+		l.Error(err)
+	}
 	return res, nil
 }
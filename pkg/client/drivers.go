@@ -2,38 +2,58 @@ package client
 
 import (
 	"github.com/robertlestak/sigc/drivers/cassandra"
+	"github.com/robertlestak/sigc/drivers/clickhouse"
 	"github.com/robertlestak/sigc/drivers/cockroachdb"
+	"github.com/robertlestak/sigc/drivers/http"
+	"github.com/robertlestak/sigc/drivers/mongodb"
 	"github.com/robertlestak/sigc/drivers/mssql"
 	"github.com/robertlestak/sigc/drivers/mysql"
 	"github.com/robertlestak/sigc/drivers/postgres"
+	"github.com/robertlestak/sigc/drivers/redis"
 	"github.com/robertlestak/sigc/drivers/scylla"
+	"github.com/robertlestak/sigc/drivers/sqlite"
 )
 
 type DriverName string
 
 var (
 	DriverCassandra   DriverName = "cassandra"
+	DriverClickHouse  DriverName = "clickhouse"
 	DriverCockroachDB DriverName = "cockroachdb"
+	DriverMongoDB     DriverName = "mongodb"
+	DriverHTTP        DriverName = "http"
 	DriverPostgres    DriverName = "postgres"
 	DriverMSsql       DriverName = "mssql"
 	DriverMysql       DriverName = "mysql"
+	DriverRedis       DriverName = "redis"
 	DriverScylla      DriverName = "scylla"
+	DriverSqlite      DriverName = "sqlite"
 )
 
 func GetDriver(driver DriverName) Client {
 	switch driver {
 	case DriverCassandra:
 		return &cassandra.Cassandra{}
+	case DriverClickHouse:
+		return &clickhouse.ClickHouse{}
 	case DriverCockroachDB:
 		return &cockroachdb.CockroachDB{}
+	case DriverMongoDB:
+		return &mongodb.MongoDB{}
+	case DriverHTTP:
+		return &http.HTTP{}
 	case DriverPostgres:
 		return &postgres.Postgres{}
 	case DriverMSsql:
 		return &mssql.MSSql{}
 	case DriverMysql:
 		return &mysql.Mysql{}
+	case DriverRedis:
+		return &redis.Redis{}
 	case DriverScylla:
 		return &scylla.Scylla{}
+	case DriverSqlite:
+		return &sqlite.Sqlite{}
 	}
 	return nil
 }
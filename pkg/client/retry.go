@@ -0,0 +1,106 @@
+package client
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/robertlestak/sigc/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryClassifier is implemented by drivers which can tell transient
+// errors, after which a statement can safely be run again, from others.
+type RetryClassifier interface {
+	Retryable(err error) bool
+}
+
+// RetryPolicy bounds how often and how quickly a statement is retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used for any setting not configured in the
+// environment.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// RetryPolicyFromEnv reads the retry policy from RETRY_MAX_ATTEMPTS,
+// RETRY_BASE_DELAY and RETRY_MAX_DELAY.
+func RetryPolicyFromEnv() RetryPolicy {
+	l := log.WithFields(log.Fields{
+		"app": "client",
+		"fn":  "RetryPolicyFromEnv",
+	})
+	p := DefaultRetryPolicy
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			p.MaxAttempts = n
+		} else {
+			l.Warnf("ignoring invalid RETRY_MAX_ATTEMPTS %q", v)
+		}
+	}
+	if v := os.Getenv("RETRY_BASE_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			p.BaseDelay = d
+		} else {
+			l.Warnf("ignoring invalid RETRY_BASE_DELAY %q", v)
+		}
+	}
+	if v := os.Getenv("RETRY_MAX_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			p.MaxDelay = d
+		} else {
+			l.Warnf("ignoring invalid RETRY_MAX_DELAY %q", v)
+		}
+	}
+	return p
+}
+
+// Backoff returns the delay before retry attempt n, counting from 1. The
+// delay doubles with each attempt up to MaxDelay, and is jittered so
+// competing transactions do not retry in lockstep.
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// execWithRetry runs r with exec, retrying the transient errors of driver d
+// according to p if the statement is idempotent or runs in a transaction.
+func execWithRetry(d Client, exec func(*schema.Request) *schema.Response, r *schema.Request, p RetryPolicy) *schema.Response {
+	l := log.WithFields(log.Fields{
+		"app": "client",
+		"fn":  "execWithRetry",
+	})
+	l.Debug("start")
+	res := exec(r)
+	rc, ok := d.(RetryClassifier)
+	if !ok || !(r.Options.Idempotent || r.Options.Transaction) {
+		return res
+	}
+	for attempt := 1; attempt < p.MaxAttempts; attempt++ {
+		if res == nil || res.Error == nil || !rc.Retryable(res.Error) {
+			return res
+		}
+		delay := p.Backoff(attempt)
+		l.WithField("attempt", attempt).Debugf("retrying in %s: %v", delay, res.Error)
+		time.Sleep(delay)
+		res = exec(r)
+	}
+	return res
+}
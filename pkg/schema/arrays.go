@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/robertlestak/sigc/internal/utils"
+)
+
+// validateParamTypes checks the declared param types of a request.
+func (r *SignRequest) validateParamTypes() error {
+	if len(r.ParamTypes) == 0 {
+		if r.MaxArrayLength != 0 {
+			return errors.New("max_array_length requires array param_types")
+		}
+		return nil
+	}
+	if r.Kind != "" && r.Kind != KindStatement {
+		return fmt.Errorf("param_types are not supported for kind %s", r.Kind)
+	}
+	switch r.Connection.Driver {
+	case "http", "redis":
+		return fmt.Errorf("param_types are not supported by %s", r.Connection.Driver)
+	}
+	if len(r.ParamTypes) != r.ParamCount {
+		return errors.New("param_types must have param_count types")
+	}
+	arrays := false
+	for i, t := range r.ParamTypes {
+		if t == "" {
+			continue
+		}
+		elem, ok := utils.ArrayElemType(t)
+		if !ok {
+			return fmt.Errorf("param_types[%d] must be empty or array<T>", i)
+		}
+		switch elem {
+		case "int", "float", "string", "bool":
+		default:
+			return fmt.Errorf("param_types[%d] element type must be int, float, string or bool", i)
+		}
+		arrays = true
+	}
+	if arrays && r.MaxArrayLength <= 0 {
+		return errors.New("max_array_length must be greater than 0 for array param_types")
+	}
+	return nil
+}
+
+// validateArrayParams checks the client's values for array params against
+// the signed request s.
+func validateArrayParams(params []any, s *SignRequest) error {
+	for i, t := range s.ParamTypes {
+		elem, ok := utils.ArrayElemType(t)
+		if !ok || i >= len(params) {
+			continue
+		}
+		vals, err := utils.ArrayValues(params[i], elem)
+		if err != nil {
+			return fmt.Errorf("params[%d] %w", i, err)
+		}
+		if len(vals) > s.MaxArrayLength {
+			return fmt.Errorf("params[%d] must not have more than %d elements", i, s.MaxArrayLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrCallerNotBound is returned when a signed request is executed by a
+	// caller other than the one it is bound to.
+	ErrCallerNotBound = errors.New("request is bound to another caller")
+)
+
+// Caller is the identity of the client executing a signed request, as
+// authenticated by the exec server. Fields are empty if the client did not
+// present the matching credentials.
+type Caller struct {
+	APIKeyID        string
+	CertFingerprint string
+	Subject         string
+	Audience        []string
+	// Proof is the caller's proof of possession of the client key, and
+	// ParamsHash the base64url encoded sha256 of the params it sent.
+	Proof      string
+	ParamsHash string
+	// IP is the caller's address, after trusted proxies.
+	IP net.IP
+	// IdempotencyKey is a key the caller sends so that retries of a call
+	// are only executed once.
+	IdempotencyKey string
+}
+
+// Binding restricts a signed request to a caller. Every field which is set
+// must match the caller.
+type Binding struct {
+	// APIKeyID is the ID of the API key the caller authenticates with.
+	APIKeyID string `json:"api_key_id,omitempty"`
+	// CertFingerprint is the hex encoded sha256 fingerprint of the client
+	// certificate the caller connects with.
+	CertFingerprint string `json:"cert_fingerprint,omitempty"`
+	// Subject and Audience are the sub and one of the aud claims of the
+	// caller's bearer token.
+	Subject  string `json:"sub,omitempty"`
+	Audience string `json:"aud,omitempty"`
+}
+
+func (b *Binding) validate() error {
+	if b.APIKeyID == "" && b.CertFingerprint == "" && b.Subject == "" && b.Audience == "" {
+		return errors.New("bind_to must set api_key_id, cert_fingerprint, sub or aud")
+	}
+	if b.CertFingerprint != "" {
+		b.CertFingerprint = strings.ToLower(strings.ReplaceAll(b.CertFingerprint, ":", ""))
+		fp, err := hex.DecodeString(b.CertFingerprint)
+		if err != nil || len(fp) != 32 {
+			return errors.New("bind_to.cert_fingerprint must be a hex encoded sha256")
+		}
+	}
+	return nil
+}
+
+// Allows returns nil if the caller may execute a request with the binding.
+// A nil binding allows any caller.
+func (b *Binding) Allows(c *Caller) error {
+	if b == nil {
+		return nil
+	}
+	if c == nil {
+		c = &Caller{}
+	}
+	if b.APIKeyID != "" && b.APIKeyID != c.APIKeyID {
+		return fmt.Errorf("%w: api key", ErrCallerNotBound)
+	}
+	if b.CertFingerprint != "" && b.CertFingerprint != c.CertFingerprint {
+		return fmt.Errorf("%w: client certificate", ErrCallerNotBound)
+	}
+	if b.Subject != "" && b.Subject != c.Subject {
+		return fmt.Errorf("%w: token subject", ErrCallerNotBound)
+	}
+	if b.Audience != "" {
+		for _, a := range c.Audience {
+			if a == b.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: token audience", ErrCallerNotBound)
+	}
+	return nil
+}
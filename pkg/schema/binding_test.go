@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBindingAllows(t *testing.T) {
+	fp := "ab0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd"
+	caller := &Caller{
+		APIKeyID:        "ci",
+		CertFingerprint: fp,
+		Subject:         "alice",
+		Audience:        []string{"sigc", "other"},
+	}
+	tests := []struct {
+		name    string
+		binding *Binding
+		caller  *Caller
+		wantErr bool
+	}{
+		{"nil binding", nil, nil, false},
+		{"nil binding any caller", nil, caller, false},
+		{"api key", &Binding{APIKeyID: "ci"}, caller, false},
+		{"other api key", &Binding{APIKeyID: "deploy"}, caller, true},
+		{"cert", &Binding{CertFingerprint: fp}, caller, false},
+		{"other cert", &Binding{CertFingerprint: "00" + fp[2:]}, caller, true},
+		{"subject and audience", &Binding{Subject: "alice", Audience: "other"}, caller, false},
+		{"other subject", &Binding{Subject: "bob", Audience: "sigc"}, caller, true},
+		{"other audience", &Binding{Subject: "alice", Audience: "admin"}, caller, true},
+		{"every field", &Binding{APIKeyID: "ci", CertFingerprint: fp, Subject: "alice", Audience: "sigc"}, caller, false},
+		{"one field differs", &Binding{APIKeyID: "ci", CertFingerprint: fp, Subject: "bob"}, caller, true},
+		{"anonymous caller", &Binding{APIKeyID: "ci"}, nil, true},
+		{"empty caller", &Binding{Audience: "sigc"}, &Caller{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.binding.Allows(tt.caller)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Allows() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrCallerNotBound) {
+				t.Errorf("Allows() error = %v, want ErrCallerNotBound", err)
+			}
+		})
+	}
+}
+
+func TestBindingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding Binding
+		want    string
+		wantErr bool
+	}{
+		{"empty", Binding{}, "", true},
+		{"colons and case", Binding{CertFingerprint: "AB:CD:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789ab"}, "abcd0123456789abcdef0123456789abcdef0123456789abcdef0123456789ab", false},
+		{"short fingerprint", Binding{CertFingerprint: "abcd"}, "", true},
+		{"not hex", Binding{CertFingerprint: "zz"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.binding.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.binding.CertFingerprint != tt.want {
+				t.Errorf("cert_fingerprint = %q, want %q", tt.binding.CertFingerprint, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Bulk row formats accepted by ParseRows.
+const (
+	RowsJSON   = "json"
+	RowsNDJSON = "ndjson"
+	RowsCSV    = "csv"
+)
+
+// validateBulk checks a bulk insert is valid for the request's driver.
+func (r *SignRequest) validateBulk() error {
+	switch r.Connection.Driver {
+	case "cassandra", "cockroachdb", "mssql", "mysql", "postgres", "scylla":
+	default:
+		return fmt.Errorf("kind bulk is not supported by %s", r.Connection.Driver)
+	}
+	if !qualifiedNameRe.MatchString(r.Statement) {
+		return errors.New("statement must be a table name for kind bulk")
+	}
+	switch r.Connection.Driver {
+	case "cockroachdb", "postgres":
+		if _, _, err := SplitTableName(r.Statement); err != nil {
+			return err
+		}
+	}
+	if len(r.Columns) == 0 {
+		return errors.New("columns is required for kind bulk")
+	}
+	seen := map[string]bool{}
+	for i, c := range r.Columns {
+		if !identifierRe.MatchString(c) {
+			return fmt.Errorf("columns[%d] must be an identifier", i)
+		}
+		if seen[strings.ToLower(c)] {
+			return fmt.Errorf("columns[%d] %s is not unique", i, c)
+		}
+		seen[strings.ToLower(c)] = true
+	}
+	if r.ParamCount != len(r.Columns) {
+		return errors.New("param_count must match the number of columns")
+	}
+	if r.MaxRows <= 0 {
+		return errors.New("max_rows must be greater than 0 for kind bulk")
+	}
+	return nil
+}
+
+// SplitTableName splits a table name of the form table or schema.table
+// into its schema, which is empty if it is not qualified, and table.
+func SplitTableName(name string) (string, string, error) {
+	parts := strings.Split(name, ".")
+	for _, p := range parts {
+		if !identifierRe.MatchString(p) {
+			return "", "", fmt.Errorf("table %s must be of the form table or schema.table", name)
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return "", parts[0], nil
+	case 2:
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("table %s must be of the form table or schema.table", name)
+}
+
+// validateRows checks the rows posted for a bulk insert against the
+// signed request s.
+func validateRows(rows [][]any, s *SignRequest) error {
+	if len(rows) == 0 {
+		return errors.New("rows is required")
+	}
+	if len(rows) > s.MaxRows {
+		return fmt.Errorf("rows must not contain more than %d rows", s.MaxRows)
+	}
+	for i, row := range rows {
+		if len(row) != s.ParamCount {
+			return fmt.Errorf("rows[%d] must contain %d values", i, s.ParamCount)
+		}
+	}
+	return nil
+}
+
+// ParseRows reads the rows of a bulk insert in the given format, stopping
+// with an error once more than max rows have been read. JSON is an array of
+// rows, NDJSON one row per line and each row an array of values in column
+// order. CSV records are read as string values in column order, skipping
+// the first record if header is set.
+func ParseRows(r io.Reader, format string, header bool, max int) ([][]any, error) {
+	var rows [][]any
+	tooMany := fmt.Errorf("rows must not contain more than %d rows", max)
+	switch format {
+	case RowsJSON:
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("rows must be a JSON array of arrays: %w", err)
+		}
+		if len(rows) > max {
+			return nil, tooMany
+		}
+	case RowsNDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1<<20)
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+			var row []any
+			if err := json.Unmarshal([]byte(line), &row); err != nil {
+				return nil, fmt.Errorf("line %d must be a JSON array: %w", n, err)
+			}
+			if len(rows) == max {
+				return nil, tooMany
+			}
+			rows = append(rows, row)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	case RowsCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		for first := true; ; first = false {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if first && header {
+				continue
+			}
+			if len(rows) == max {
+				return nil, tooMany
+			}
+			row := make([]any, len(rec))
+			for i, v := range rec {
+				row[i] = v
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, fmt.Errorf("rows format %s is not supported", format)
+	}
+	return rows, nil
+}
@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kind is the kind of statement a signed request runs.
+type Kind string
+
+const (
+	// KindStatement runs the statement as is. It is the default.
+	KindStatement Kind = "statement"
+	// KindCall calls the stored procedure named by the statement with the
+	// declared proc_params.
+	KindCall Kind = "call"
+	// KindBulk inserts the rows posted by the client into the table named
+	// by the statement.
+	KindBulk Kind = "bulk"
+)
+
+// ProcParamDirection is the direction of a stored procedure param.
+type ProcParamDirection string
+
+const (
+	ProcParamIn    ProcParamDirection = "IN"
+	ProcParamOut   ProcParamDirection = "OUT"
+	ProcParamInOut ProcParamDirection = "INOUT"
+)
+
+var (
+	// qualifiedNameRe matches an optionally schema qualified name.
+	qualifiedNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$#]*(\.[A-Za-z_][A-Za-z0-9_$#]*){0,2}$`)
+	// identifierRe matches a param or column name.
+	identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// procParamTypeRe matches a type such as int, nvarchar(100),
+	// varchar(max) or decimal(10, 2).
+	procParamTypeRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ ]*(\(([0-9]+(, ?[0-9]+)?|max|MAX)\))?$`)
+)
+
+// ProcParam declares a param of a stored procedure call. IN and INOUT
+// params take their values from the client's params, in order. Type is
+// the data source type of the param and is required for OUT and INOUT
+// params.
+type ProcParam struct {
+	Name      string             `json:"name"`
+	Direction ProcParamDirection `json:"direction,omitempty"`
+	Type      string             `json:"type,omitempty"`
+}
+
+// In reports whether the param takes a value from the client.
+func (p ProcParam) In() bool {
+	return p.Direction == ProcParamIn || p.Direction == ProcParamInOut
+}
+
+// Out reports whether the param returns a value.
+func (p ProcParam) Out() bool {
+	return p.Direction == ProcParamOut || p.Direction == ProcParamInOut
+}
+
+// validateCall checks a stored procedure call is valid for the request's
+// driver, and normalizes the direction of its params.
+func (r *SignRequest) validateCall() error {
+	switch r.Connection.Driver {
+	case "mssql", "mysql", "postgres":
+	default:
+		return fmt.Errorf("kind call is not supported by %s", r.Connection.Driver)
+	}
+	if !qualifiedNameRe.MatchString(r.Statement) {
+		return fmt.Errorf("statement must be a procedure name for kind call")
+	}
+	in := 0
+	seen := map[string]bool{}
+	for i := range r.ProcParams {
+		p := &r.ProcParams[i]
+		if !identifierRe.MatchString(p.Name) {
+			return fmt.Errorf("proc_params[%d].name must be an identifier", i)
+		}
+		if seen[strings.ToLower(p.Name)] {
+			return fmt.Errorf("proc_params[%d].name %s is not unique", i, p.Name)
+		}
+		seen[strings.ToLower(p.Name)] = true
+		p.Direction = ProcParamDirection(strings.ToUpper(string(p.Direction)))
+		if p.Direction == "" {
+			p.Direction = ProcParamIn
+		}
+		switch p.Direction {
+		case ProcParamIn, ProcParamOut, ProcParamInOut:
+		default:
+			return fmt.Errorf("proc_params[%d].direction must be IN, OUT or INOUT", i)
+		}
+		if p.Type != "" && !procParamTypeRe.MatchString(p.Type) {
+			return fmt.Errorf("proc_params[%d].type %s is not a valid type", i, p.Type)
+		}
+		if p.Out() && p.Type == "" {
+			return fmt.Errorf("proc_params[%d].type is required for %s params", i, p.Direction)
+		}
+		if p.In() {
+			in++
+		}
+	}
+	if in != r.ParamCount {
+		return fmt.Errorf("param_count must match the %d IN and INOUT proc_params", in)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package schema
+
+// RedisReadCommands are the read only Redis commands. They are the
+// commands the redis driver allows when its commands param is not set, and
+// the commands the policy classifier treats as reads.
+var RedisReadCommands = map[string]bool{
+	"GET": true, "MGET": true, "GETRANGE": true, "STRLEN": true,
+	"EXISTS": true, "TTL": true, "PTTL": true, "TYPE": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HKEYS": true,
+	"HVALS": true, "HLEN": true, "HEXISTS": true, "HSCAN": true,
+	"LRANGE": true, "LLEN": true, "LINDEX": true,
+	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true, "SSCAN": true,
+	"ZRANGE": true, "ZRANGEBYSCORE": true, "ZREVRANGE": true,
+	"ZREVRANGEBYSCORE": true, "ZSCORE": true, "ZCARD": true,
+	"ZCOUNT": true, "ZRANK": true, "ZREVRANK": true, "ZSCAN": true,
+	"XRANGE": true, "XREVRANGE": true, "XREAD": true, "XLEN": true,
+	"GETBIT": true, "BITCOUNT": true, "PFCOUNT": true,
+}
+
+// MongoReadCommands are the read only MongoDB commands the policy
+// classifier treats as reads.
+var MongoReadCommands = map[string]bool{
+	"find": true, "aggregate": true, "count": true, "countDocuments": true,
+	"distinct": true,
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrAddressNotAllowed is returned when a signed request is executed
+	// from an address outside of its allowed CIDRs.
+	ErrAddressNotAllowed = errors.New("address is not allowed")
+)
+
+// ParseCIDROrIP parses a CIDR, or a bare address as a single address CIDR.
+func ParseCIDROrIP(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%s is not a valid CIDR or address", s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		return &net.IPNet{IP: ip.Mask(net.CIDRMask(bits, bits)), Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid CIDR or address", s)
+	}
+	return n, nil
+}
+
+// validateAllowedCIDRs checks the allowed CIDRs, and rewrites bare
+// addresses as single address CIDRs.
+func (r *SignRequest) validateAllowedCIDRs() error {
+	for i, c := range r.AllowedCIDRs {
+		n, err := ParseCIDROrIP(c)
+		if err != nil {
+			return fmt.Errorf("allowed_cidrs[%d]: %w", i, err)
+		}
+		r.AllowedCIDRs[i] = n.String()
+	}
+	return nil
+}
+
+// addrAllowed returns nil if ip is in one of cidrs. Any address is allowed
+// if there are no cidrs.
+func addrAllowed(cidrs []string, ip net.IP) error {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	if ip == nil {
+		return fmt.Errorf("%w: caller address is unknown", ErrAddressNotAllowed)
+	}
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrAddressNotAllowed, ip)
+}
+
+// AddrAllowed returns nil if the caller's address is in the request's
+// allowed CIDRs.
+func (r *SignRequest) AddrAllowed(c *Caller) error {
+	var ip net.IP
+	if c != nil {
+		ip = c.IP
+	}
+	return addrAllowed(r.AllowedCIDRs, ip)
+}
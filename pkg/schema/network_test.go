@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseCIDROrIP(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{" 192.0.2.1 ", "192.0.2.1/32", false},
+		{"2001:db8::1", "2001:db8::1/128", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"::ffff:192.0.2.1", "192.0.2.1/32", false},
+		{"192.0.2.300", "", true},
+		{"10.0.0.0/33", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			n, err := ParseCIDROrIP(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCIDROrIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && n.String() != tt.want {
+				t.Errorf("ParseCIDROrIP() = %s, want %s", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddrAllowed(t *testing.T) {
+	r := &SignRequest{AllowedCIDRs: []string{"10.0.0.0/8", "192.0.2.1"}}
+	if err := r.validateAllowedCIDRs(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		caller  *Caller
+		wantErr bool
+	}{
+		{"in cidr", &Caller{IP: net.ParseIP("10.2.3.4")}, false},
+		{"single address", &Caller{IP: net.ParseIP("192.0.2.1")}, false},
+		{"outside", &Caller{IP: net.ParseIP("192.0.2.2")}, true},
+		{"unknown address", &Caller{}, true},
+		{"no caller", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.AddrAllowed(tt.caller)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddrAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrAddressNotAllowed) {
+				t.Errorf("AddrAllowed() error = %v, want ErrAddressNotAllowed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robertlestak/sigc/internal/utils"
+)
+
+// ParamType is the type of a driver connection param.
+type ParamType string
+
+const (
+	ParamString   ParamType = "string"
+	ParamInt      ParamType = "int"
+	ParamBool     ParamType = "bool"
+	ParamDuration ParamType = "duration"
+	ParamList     ParamType = "list"
+	ParamMap      ParamType = "map"
+)
+
+// redacted replaces secret param values in logs.
+const redacted = "REDACTED"
+
+// ConnectionParam describes a connection param accepted by a driver.
+type ConnectionParam struct {
+	Name        string    `json:"name"`
+	Aliases     []string  `json:"aliases,omitempty"`
+	Type        ParamType `json:"type"`
+	Required    bool      `json:"required"`
+	Secret      bool      `json:"secret"`
+	Default     any       `json:"default,omitempty"`
+	Description string    `json:"description"`
+}
+
+var driverParams = map[string][]ConnectionParam{}
+
+// RegisterDriverParams registers the connection params accepted by a
+// driver. Drivers register their params when their package is imported.
+func RegisterDriverParams(driver string, params []ConnectionParam) {
+	driverParams[driver] = params
+}
+
+// DriverParams returns the connection params accepted by a driver.
+func DriverParams(driver string) ([]ConnectionParam, bool) {
+	p, ok := driverParams[driver]
+	return p, ok
+}
+
+// Drivers returns the names of all drivers with registered params.
+func Drivers() []string {
+	var d []string
+	for k := range driverParams {
+		d = append(d, k)
+	}
+	sort.Strings(d)
+	return d
+}
+
+func (p *ConnectionParam) names() []string {
+	return append([]string{p.Name}, p.Aliases...)
+}
+
+// parse returns the value of the param in params converted to the param's
+// type.
+func (p *ConnectionParam) parse(params map[string]any, name string) (any, error) {
+	switch p.Type {
+	case ParamString:
+		return utils.StringParam(params, name)
+	case ParamInt:
+		return utils.IntParam(params, name)
+	case ParamBool:
+		return utils.BoolParam(params, name)
+	case ParamDuration:
+		return utils.DurationParam(params, name)
+	case ParamList:
+		return utils.StringSliceParam(params, name)
+	case ParamMap:
+		return utils.StringMapParam(params, name)
+	}
+	return nil, fmt.Errorf("%s has unknown type %s", name, p.Type)
+}
+
+// ParamValues are connection params parsed against a driver's params,
+// keyed by param name. Params which are not set and have no default are
+// absent, and their getters return the zero value.
+type ParamValues map[string]any
+
+// ParseParams parses connection params against a driver's params. Aliases
+// are resolved to the param name, defaults are applied and values are
+// converted to the param's type. Unknown params, missing required params
+// and params of the wrong type are rejected.
+func ParseParams(specs []ConnectionParam, params map[string]any) (ParamValues, error) {
+	known := map[string]bool{}
+	for i := range specs {
+		for _, n := range specs[i].names() {
+			known[n] = true
+		}
+	}
+	for k := range params {
+		if !known[k] {
+			return nil, fmt.Errorf("%s is not supported", k)
+		}
+	}
+	v := ParamValues{}
+	for i := range specs {
+		p := &specs[i]
+		src, name := params, ""
+		for _, n := range p.names() {
+			if params[n] != nil {
+				name = n
+				break
+			}
+		}
+		if name == "" {
+			if p.Required {
+				return nil, fmt.Errorf("%s is required", p.Name)
+			}
+			if p.Default == nil {
+				continue
+			}
+			src, name = map[string]any{p.Name: p.Default}, p.Name
+		}
+		pv, err := p.parse(src, name)
+		if err != nil {
+			return nil, err
+		}
+		v[p.Name] = pv
+	}
+	return v, nil
+}
+
+// String returns the value of a string param.
+func (v ParamValues) String(name string) string {
+	s, _ := v[name].(string)
+	return s
+}
+
+// Int returns the value of an int param.
+func (v ParamValues) Int(name string) int {
+	i, _ := v[name].(int)
+	return i
+}
+
+// Bool returns the value of a bool param.
+func (v ParamValues) Bool(name string) bool {
+	b, _ := v[name].(bool)
+	return b
+}
+
+// Duration returns the value of a duration param.
+func (v ParamValues) Duration(name string) time.Duration {
+	d, _ := v[name].(time.Duration)
+	return d
+}
+
+// List returns the value of a list param.
+func (v ParamValues) List(name string) []string {
+	l, _ := v[name].([]string)
+	return l
+}
+
+// Map returns the value of a map param.
+func (v ParamValues) Map(name string) map[string]string {
+	m, _ := v[name].(map[string]string)
+	return m
+}
+
+// Port returns the value of an int param as a TCP port.
+func (v ParamValues) Port(name string) (string, error) {
+	return utils.PortParam(v, name)
+}
+
+// Validate checks the connection params against the params registered for
+// the connection's driver. Unknown params, missing required params and
+// params of the wrong type are rejected.
+func (c *Connection) Validate() error {
+	specs, ok := DriverParams(c.Driver)
+	if !ok {
+		return fmt.Errorf("connection.driver %s is not supported", c.Driver)
+	}
+	if _, err := ParseParams(specs, c.Params); err != nil {
+		return fmt.Errorf("connection.params.%v", err)
+	}
+	return nil
+}
+
+// RedactedParams returns a copy of the connection params with the values
+// of secret params replaced, for logging.
+func (c *Connection) RedactedParams() map[string]any {
+	secret := map[string]bool{}
+	if specs, ok := DriverParams(c.Driver); ok {
+		for _, p := range specs {
+			for _, n := range p.names() {
+				secret[n] = p.Secret
+			}
+		}
+	}
+	m := make(map[string]any, len(c.Params))
+	for k, v := range c.Params {
+		// params unknown to the driver are redacted as they may be secret
+		if s, ok := secret[k]; !ok || s {
+			m[k] = redacted
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// Fingerprint identifies the data source of the connection, as a hex
+// encoded hash of its driver and the string values of its non-secret
+// params. Connections which only differ by their secret params, such as
+// their passwords, have the same fingerprint.
+func (c *Connection) Fingerprint() string {
+	params := map[string]string{}
+	for k, v := range c.RedactedParams() {
+		if v != redacted && v != nil {
+			params[k] = fmt.Sprint(v)
+		}
+	}
+	// json.Marshal sorts the map keys, so the encoding is stable
+	b, _ := json.Marshal(struct {
+		Driver string            `json:"driver"`
+		Params map[string]string `json:"params"`
+	}{c.Driver, params})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+// ParamsMarkdown renders the connection params of a driver as a markdown
+// list.
+func ParamsMarkdown(driver string) string {
+	specs, _ := DriverParams(driver)
+	var b strings.Builder
+	for _, p := range specs {
+		fmt.Fprintf(&b, "* `%s` - %s", p.Name, p.Description)
+		var notes []string
+		if p.Required {
+			notes = append(notes, "Required.")
+		}
+		if p.Default != nil {
+			notes = append(notes, fmt.Sprintf("Defaults to `%v`.", p.Default))
+		}
+		if p.Secret {
+			notes = append(notes, "Secret.")
+		}
+		if len(notes) > 0 {
+			b.WriteString(" " + strings.Join(notes, " "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
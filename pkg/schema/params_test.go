@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+var testParams = []ConnectionParam{
+	{Name: "host", Type: ParamString, Required: true},
+	{Name: "port", Type: ParamInt, Required: true},
+	{Name: "pass", Aliases: []string{"password"}, Type: ParamString, Secret: true},
+	{Name: "timeout", Type: ParamDuration, Default: "10s"},
+	{Name: "tls", Type: ParamBool, Default: false},
+	{Name: "hosts", Type: ParamList},
+	{Name: "headers", Type: ParamMap},
+}
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]any
+		wantErr bool
+		check   func(t *testing.T, v ParamValues)
+	}{
+		{
+			name:   "defaults",
+			params: map[string]any{"host": "db", "port": "5432"},
+			check: func(t *testing.T, v ParamValues) {
+				if v.String("host") != "db" || v.Int("port") != 5432 {
+					t.Errorf("host, port = %q, %d", v.String("host"), v.Int("port"))
+				}
+				if v.Duration("timeout") != 10*time.Second {
+					t.Errorf("timeout = %s, want 10s", v.Duration("timeout"))
+				}
+				if _, ok := v["hosts"]; ok {
+					t.Errorf("hosts is set without a value or default")
+				}
+			},
+		},
+		{
+			name: "types",
+			params: map[string]any{
+				"host": "db", "port": float64(5432), "timeout": float64(3),
+				"tls": "true", "hosts": "a, b", "headers": map[string]any{"X-A": "1"},
+			},
+			check: func(t *testing.T, v ParamValues) {
+				if v.Duration("timeout") != 3*time.Second || !v.Bool("tls") {
+					t.Errorf("timeout, tls = %s, %v", v.Duration("timeout"), v.Bool("tls"))
+				}
+				if l := v.List("hosts"); len(l) != 2 || l[1] != "b" {
+					t.Errorf("hosts = %v", l)
+				}
+				if v.Map("headers")["X-A"] != "1" {
+					t.Errorf("headers = %v", v.Map("headers"))
+				}
+			},
+		},
+		{
+			name:   "alias",
+			params: map[string]any{"host": "db", "port": 1, "password": "secret"},
+			check: func(t *testing.T, v ParamValues) {
+				if v.String("pass") != "secret" {
+					t.Errorf("pass = %q, want secret", v.String("pass"))
+				}
+			},
+		},
+		{
+			name:    "missing required",
+			params:  map[string]any{"host": "db"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			params:  map[string]any{"host": "db", "port": 1, "sslmode": "disable"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			params:  map[string]any{"host": "db", "port": "http"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ParseParams(testParams, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robertlestak/sigc/internal/keys"
+)
+
+// maxRateLimits is the maximum number of rate limits of a request.
+const maxRateLimits = 8
+
+// RateLimit allows at most Limit executions of a signed request in any
+// Window, a duration such as 1m or 24h.
+type RateLimit struct {
+	Limit  int    `json:"limit"`
+	Window string `json:"window"`
+}
+
+// RateLimitError is returned when a signed request is executed more often
+// than its rate limits allow.
+type RateLimitError struct {
+	Status *keys.RateLimitStatus
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %d per %s exceeded, retry after %s", e.Status.Limit, e.Status.Window, e.Status.RetryAfter.Round(time.Second))
+}
+
+func (r *SignRequest) validateRateLimits() error {
+	if len(r.RateLimits) > maxRateLimits {
+		return fmt.Errorf("at most %d rate_limits are supported", maxRateLimits)
+	}
+	for i, rl := range r.RateLimits {
+		if rl.Limit < 1 {
+			return fmt.Errorf("rate_limits[%d]: limit must be greater than 0", i)
+		}
+		w, err := time.ParseDuration(rl.Window)
+		if err != nil || w < time.Second {
+			return fmt.Errorf("rate_limits[%d]: window must be a duration of at least 1s, such as 1m or 24h", i)
+		}
+	}
+	return nil
+}
+
+// KeyRateLimits returns the request's rate limits for the key store.
+func (r *SignRequest) KeyRateLimits() ([]keys.RateLimit, error) {
+	var out []keys.RateLimit
+	for _, rl := range r.RateLimits {
+		w, err := time.ParseDuration(rl.Window)
+		if err != nil {
+			return nil, errors.New("rate_limits are invalid")
+		}
+		out = append(out, keys.RateLimit{Limit: rl.Limit, Window: w})
+	}
+	return out, nil
+}
@@ -1,8 +1,14 @@
 package schema
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gocql/gocql"
@@ -10,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/robertlestak/sigc/internal/cache"
 	"github.com/robertlestak/sigc/internal/keys"
+	"github.com/robertlestak/sigc/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,35 +32,124 @@ type SignedRequest struct {
 	Signature  *string `json:"signature"`
 	Params     []any   `json:"params,omitempty"`
 	ExpiresAt  int64   `json:"expires_at,omitempty"`
+	NotBefore  int64   `json:"not_before,omitempty"`
+	Rows       [][]any `json:"rows,omitempty"`
 }
 
 type SecureRequest struct {
-	ID         string     `json:"id"`
-	Statement  string     `json:"statement"`
-	Connection Connection `json:"connection"`
-	ParamCount int        `json:"param_count"`
-	ExpiresAt  int64      `json:"expires_at,omitempty"`
+	ID             string       `json:"id"`
+	Statement      string       `json:"statement"`
+	Connection     Connection   `json:"connection"`
+	ParamCount     int          `json:"param_count"`
+	ExpiresAt      int64        `json:"expires_at,omitempty"`
+	Options        QueryOptions `json:"options,omitempty"`
+	Kind           Kind         `json:"kind,omitempty"`
+	ProcParams     []ProcParam  `json:"proc_params,omitempty"`
+	Columns        []string     `json:"columns,omitempty"`
+	MaxRows        int          `json:"max_rows,omitempty"`
+	ParamTypes     []string     `json:"param_types,omitempty"`
+	MaxArrayLength int          `json:"max_array_length,omitempty"`
+	SignedBy       string       `json:"signed_by,omitempty"`
+	BindTo         *Binding     `json:"bind_to,omitempty"`
+	ClientKey      string       `json:"client_key_thumbprint,omitempty"`
+	AllowedCIDRs   []string     `json:"allowed_cidrs,omitempty"`
+	NotBefore      int64        `json:"not_before,omitempty"`
+	Windows        []TimeWindow `json:"windows,omitempty"`
+	RateLimits     []RateLimit  `json:"rate_limits,omitempty"`
 }
 
 type SignRequest struct {
-	Statement  string     `json:"statement"`
-	Connection Connection `json:"connection"`
-	ParamCount int        `json:"param_count"`
-	Params     []any      `json:"params,omitempty"`
-	PrivateKey []byte     `json:"private_key"`
-	MaxUses    int        `json:"max_uses"`
-	ExpiresAt  int64      `json:"expires_at,omitempty"`
+	Statement          string       `json:"statement"`
+	Connection         Connection   `json:"connection"`
+	ParamCount         int          `json:"param_count"`
+	Params             []any        `json:"params,omitempty"`
+	PrivateKey         []byte       `json:"private_key"`
+	MaxUses            int          `json:"max_uses"`
+	ExpiresAt          int64        `json:"expires_at,omitempty"`
+	Options            QueryOptions `json:"options,omitempty"`
+	Kind               Kind         `json:"kind,omitempty"`
+	ProcParams         []ProcParam  `json:"proc_params,omitempty"`
+	Columns            []string     `json:"columns,omitempty"`
+	MaxRows            int          `json:"max_rows,omitempty"`
+	Rows               [][]any      `json:"-"` // sent by the client with the signed request, never stored
+	ParamTypes         []string     `json:"param_types,omitempty"`
+	MaxArrayLength     int          `json:"max_array_length,omitempty"`
+	ValidateConnection bool         `json:"validate_connection,omitempty"`
+	BindTo             *Binding     `json:"bind_to,omitempty"`
+	ClientKey          string       `json:"client_key_thumbprint,omitempty"`
+	AllowedCIDRs       []string     `json:"allowed_cidrs,omitempty"`
+	NotBefore          int64        `json:"not_before,omitempty"`
+	Windows            []TimeWindow `json:"windows,omitempty"`
+	RateLimits         []RateLimit  `json:"rate_limits,omitempty"`
+	IdleTimeout        string       `json:"idle_timeout,omitempty"`
+	// SignedBy is the principal which signed the request. It is set by the
+	// sign server from the request's credentials, never from its body.
+	SignedBy string `json:"-"`
+}
+
+// QueryOptions are statement level options which are sealed into the
+// signed request. Consistency, SerialConsistency and PageSize are only
+// supported by the CQL drivers and override their connection defaults.
+// Transaction is only supported by the SQL drivers. Statements which are
+// Idempotent or run in a Transaction are retried on transient errors.
+type QueryOptions struct {
+	Consistency       string `json:"consistency,omitempty"`
+	SerialConsistency string `json:"serial_consistency,omitempty"`
+	PageSize          int    `json:"page_size,omitempty"`
+	Idempotent        bool   `json:"idempotent,omitempty"`
+	Transaction       bool   `json:"transaction,omitempty"`
+}
+
+// Probe is the result of checking a statement against its data source
+// without executing it. ParamCount is -1 if the driver cannot tell how many
+// params the statement takes, and ParamTypes is empty if the driver cannot
+// infer their types.
+type Probe struct {
+	ParamCount int      `json:"param_count"`
+	ParamTypes []string `json:"param_types,omitempty"`
 }
 
 type Request struct {
 	Statement     string         `json:"statement"`
 	SignedRequest *SignedRequest `json:"signed_request"`
 	Params        []any          `json:"params,omitempty"`
+	Options       QueryOptions   `json:"options,omitempty"`
+	Kind          Kind           `json:"kind,omitempty"`
+	ProcParams    []ProcParam    `json:"proc_params,omitempty"`
+	Columns       []string       `json:"columns,omitempty"`
+	Rows          [][]any        `json:"rows,omitempty"`
+	ParamTypes    []string       `json:"param_types,omitempty"`
 }
 
+// Column describes a column of a result set. Type is the data source's
+// name for the column type.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// ResultSet is one of the result sets returned by a statement, in the
+// order the data source returned them.
+type ResultSet struct {
+	Columns []Column         `json:"columns"`
+	Rows    []map[string]any `json:"rows"`
+}
+
+// Response is the result of running a statement. Results holds the rows of
+// the first result set. ResultSets holds every result set returned by the
+// SQL drivers and Out the OUT params of stored procedure calls.
 type Response struct {
-	Results []map[string]any `json:"results"`
-	Error   error            `json:"error"`
+	Results    []map[string]any `json:"results"`
+	ResultSets []ResultSet      `json:"result_sets,omitempty"`
+	Out        map[string]any   `json:"out,omitempty"`
+	Error      error            `json:"error"`
+	// RateLimit is the status of the request's rate limits, which is
+	// returned in headers.
+	RateLimit *keys.RateLimitStatus `json:"-"`
+	// Replay is the encoded response of an earlier execution with the same
+	// idempotency key, which is returned instead of executing the request
+	// again.
+	Replay []byte `json:"-"`
 }
 
 func (r *SignRequest) Validate() error {
@@ -68,18 +164,114 @@ func (r *SignRequest) Validate() error {
 	if r.Connection.Driver == "" {
 		return errors.New("connection.driver is required")
 	}
+	if err := r.Connection.Validate(); err != nil {
+		return err
+	}
+	if err := r.Options.Validate(r.Connection.Driver); err != nil {
+		return err
+	}
+	switch r.Kind {
+	case "", KindStatement:
+		if len(r.ProcParams) > 0 {
+			return errors.New("proc_params require kind call")
+		}
+		if len(r.Columns) > 0 || r.MaxRows != 0 {
+			return errors.New("columns and max_rows require kind bulk")
+		}
+	case KindCall:
+		if err := r.validateCall(); err != nil {
+			return err
+		}
+	case KindBulk:
+		if len(r.ProcParams) > 0 {
+			return errors.New("proc_params require kind call")
+		}
+		if err := r.validateBulk(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("kind %s is not supported", r.Kind)
+	}
+	if err := r.validateParamTypes(); err != nil {
+		return err
+	}
 	if r.MaxUses < 0 {
 		return errors.New("max_uses must be equal or greater than 0")
 	}
 	if r.ExpiresAt < 0 {
 		return errors.New("expires_at must be equal or greater than 0")
 	}
-	if r.ExpiresAt > 0 && r.ExpiresAt < time.Now().Unix() {
+	if r.ExpiresAt > 0 && time.Unix(r.ExpiresAt, 0).Add(utils.ClockSkew()).Before(time.Now()) {
 		return errors.New("expires_at must be in the future")
 	}
+	if err := r.validateWindows(); err != nil {
+		return err
+	}
+	if err := r.validateRateLimits(); err != nil {
+		return err
+	}
+	if r.IdleTimeout != "" {
+		if d, err := time.ParseDuration(r.IdleTimeout); err != nil || d < time.Second {
+			return errors.New("idle_timeout must be a duration of at least 1s, such as 8h")
+		}
+		if r.ExpiresAt == 0 {
+			return errors.New("idle_timeout requires expires_at")
+		}
+	}
 	if r.PrivateKey == nil || len(r.PrivateKey) == 0 {
 		return errors.New("private_key is required")
 	}
+	if r.BindTo != nil {
+		if err := r.BindTo.validate(); err != nil {
+			return err
+		}
+	}
+	if r.ClientKey != "" {
+		if tp, err := base64.RawURLEncoding.DecodeString(r.ClientKey); err != nil || len(tp) != sha256.Size {
+			return errors.New("client_key_thumbprint must be a base64url encoded sha256 JWK thumbprint")
+		}
+	}
+	if err := r.validateAllowedCIDRs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks the query options are valid for driver.
+func (o *QueryOptions) Validate(driver string) error {
+	cql := driver == "cassandra" || driver == "scylla"
+	if o.Consistency != "" {
+		if !cql {
+			return fmt.Errorf("options.consistency is not supported by %s", driver)
+		}
+		if _, err := gocql.ParseConsistencyWrapper(o.Consistency); err != nil {
+			return fmt.Errorf("options.consistency %s is not a valid consistency", o.Consistency)
+		}
+	}
+	if o.SerialConsistency != "" {
+		if !cql {
+			return fmt.Errorf("options.serial_consistency is not supported by %s", driver)
+		}
+		var sc gocql.SerialConsistency
+		if err := sc.UnmarshalText([]byte(strings.ToUpper(o.SerialConsistency))); err != nil {
+			return fmt.Errorf("options.serial_consistency must be SERIAL or LOCAL_SERIAL")
+		}
+	}
+	if o.Transaction {
+		switch driver {
+		case "cockroachdb", "mssql", "mysql", "postgres", "sqlite":
+		default:
+			return fmt.Errorf("options.transaction is not supported by %s", driver)
+		}
+	}
+	if o.PageSize != 0 {
+		if !cql {
+			return fmt.Errorf("options.page_size is not supported by %s", driver)
+		}
+		if o.PageSize < 0 {
+			return errors.New("options.page_size must be equal or greater than 0")
+		}
+	}
 	return nil
 }
 
@@ -95,6 +287,12 @@ func (r *SignRequest) CreateSignedRequest() (*SignedRequest, error) {
 	if err := r.Validate(); err != nil {
 		return res, err
 	}
+	var idle time.Duration
+	if r.IdleTimeout != "" {
+		if idle, err = time.ParseDuration(r.IdleTimeout); err != nil {
+			return res, fmt.Errorf("idle_timeout is invalid: %w", err)
+		}
+	}
 	sr.ID = uuid.New().String()
 	l = l.WithField("id", sr.ID)
 	l.Debug("created id")
@@ -102,6 +300,20 @@ func (r *SignRequest) CreateSignedRequest() (*SignedRequest, error) {
 	sr.Statement = r.Statement
 	sr.Connection = r.Connection
 	sr.ExpiresAt = r.ExpiresAt
+	sr.Options = r.Options
+	sr.Kind = r.Kind
+	sr.ProcParams = r.ProcParams
+	sr.Columns = r.Columns
+	sr.MaxRows = r.MaxRows
+	sr.ParamTypes = r.ParamTypes
+	sr.MaxArrayLength = r.MaxArrayLength
+	sr.SignedBy = r.SignedBy
+	sr.BindTo = r.BindTo
+	sr.ClientKey = r.ClientKey
+	sr.AllowedCIDRs = r.AllowedCIDRs
+	sr.NotBefore = r.NotBefore
+	sr.Windows = r.Windows
+	sr.RateLimits = r.RateLimits
 	jd, err := json.Marshal(sr)
 	if err != nil {
 		return nil, err
@@ -120,7 +332,8 @@ func (r *SignRequest) CreateSignedRequest() (*SignedRequest, error) {
 	res.ParamCount = r.ParamCount
 	res.Statement = r.Statement
 	res.ExpiresAt = r.ExpiresAt
-	sk, err := keys.LoadPrivateKey(r.PrivateKey, r.MaxUses, r.ExpiresAt)
+	res.NotBefore = r.NotBefore
+	sk, err := keys.LoadPrivateKey(r.PrivateKey, r.MaxUses, r.ExpiresAt, r.SignedBy, idle)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +373,22 @@ func (r *SignedRequest) DecryptSignRequest() (*SignRequest, error) {
 	res.Statement = sr.Statement
 	res.Connection = sr.Connection
 	res.ExpiresAt = sr.ExpiresAt
+	res.Options = sr.Options
+	res.Kind = sr.Kind
+	res.ProcParams = sr.ProcParams
+	res.Columns = sr.Columns
+	res.MaxRows = sr.MaxRows
+	res.ParamTypes = sr.ParamTypes
+	res.MaxArrayLength = sr.MaxArrayLength
+	res.SignedBy = sr.SignedBy
+	res.BindTo = sr.BindTo
+	res.ClientKey = sr.ClientKey
+	res.AllowedCIDRs = sr.AllowedCIDRs
+	res.NotBefore = sr.NotBefore
+	res.Windows = sr.Windows
+	res.RateLimits = sr.RateLimits
 	res.Params = r.Params
+	res.Rows = r.Rows
 	return res, err
 }
 
@@ -180,7 +408,7 @@ func (r *SignedRequest) Validate() error {
 		return errors.New("signature is required")
 	}
 	if r.ExpiresAt > 0 {
-		t := time.Unix(r.ExpiresAt, 0)
+		t := time.Unix(r.ExpiresAt, 0).Add(utils.ClockSkew())
 		if t.Before(time.Now()) {
 			return errors.New("request has expired")
 		}
@@ -200,21 +428,98 @@ func (sr *SignedRequest) ValidatePayload(s *SignRequest) error {
 	if sr.ParamCount != s.ParamCount {
 		return errors.New("param_count does not match")
 	}
-	if len(sr.Params) != sr.ParamCount {
-		return errors.New("params does not match")
+	if s.Kind == KindBulk {
+		if len(sr.Params) > 0 {
+			return errors.New("params are not accepted for kind bulk, use rows")
+		}
+		if err := validateRows(sr.Rows, s); err != nil {
+			return err
+		}
+	} else {
+		if len(sr.Rows) > 0 {
+			return errors.New("rows are only accepted for kind bulk")
+		}
+		if len(sr.Params) != sr.ParamCount {
+			return errors.New("params does not match")
+		}
+		if err := validateArrayParams(sr.Params, s); err != nil {
+			return err
+		}
 	}
 	if sr.ExpiresAt != s.ExpiresAt {
 		return errors.New("expires_at does not match")
 	}
 	if sr.ExpiresAt > 0 {
-		t := time.Unix(sr.ExpiresAt, 0)
+		t := time.Unix(sr.ExpiresAt, 0).Add(utils.ClockSkew())
 		if t.Before(time.Now()) {
 			return errors.New("request has expired")
 		}
 	}
+	if sr.NotBefore != s.NotBefore {
+		return errors.New("not_before does not match")
+	}
+	if err := s.checkWindows(time.Now(), utils.ClockSkew()); err != nil {
+		return err
+	}
 	return nil
 }
 
+// SQLRowsToResultSets reads every result set of rows, mapping the rows of
+// each with fn. Result sets without columns, such as the status result of a
+// MySQL CALL, are skipped.
+func SQLRowsToResultSets(rows *sql.Rows, fn func(*sql.Rows) ([]map[string]any, error)) ([]ResultSet, error) {
+	var sets []ResultSet
+	for {
+		cts, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		m, err := fn(rows)
+		if err != nil {
+			return nil, err
+		}
+		if len(cts) > 0 {
+			cols := make([]Column, len(cts))
+			for i, ct := range cts {
+				cols[i] = Column{Name: ct.Name(), Type: ct.DatabaseTypeName()}
+			}
+			sets = append(sets, ResultSet{Columns: cols, Rows: m})
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// QueryResultSets runs statement on db, in a transaction if tx is set, and
+// returns every result set with its rows mapped by fn.
+func QueryResultSets(db *sql.DB, tx bool, statement string, params []any, fn func(*sql.Rows) ([]map[string]any, error)) ([]ResultSet, error) {
+	var sets []ResultSet
+	err := utils.WithConn(db, tx, func(q utils.Querier) error {
+		rows, err := q.QueryContext(context.Background(), statement, params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		sets, err = SQLRowsToResultSets(rows, fn)
+		return err
+	})
+	return sets, err
+}
+
+// SetResultSets sets the result sets of the response, with the rows of the
+// first also set as its results.
+func (r *Response) SetResultSets(sets []ResultSet) {
+	r.ResultSets = sets
+	if len(sets) > 0 {
+		r.Results = sets[0].Rows
+	}
+}
+
 func CqlRowsToMapSlice(qry *gocql.Query) ([]map[string]any, error) {
 	l := log.WithFields(log.Fields{
 		"pkg": "sqlquery",
@@ -0,0 +1,190 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// embed the time zone database so windows work without system tzdata
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// ErrOutsideWindow is returned when a signed request is executed before
+	// its not_before or outside of its time windows.
+	ErrOutsideWindow = errors.New("request is outside of its validity window")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeWindow is a recurring window in which a signed request may be
+// executed. It is either a cron schedule of the window's starts and its
+// duration, or the days and the time of day range of the window. Times are
+// in the window's time zone, UTC by default.
+type TimeWindow struct {
+	Cron     string `json:"cron,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	// Days are weekdays such as mon or ranges such as mon-fri. Empty Days
+	// are every day.
+	Days []string `json:"days,omitempty"`
+	// Start and End are times of day such as 09:00. End is exclusive, may
+	// be 24:00, and if it is before Start the window ends the next day.
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	TimeZone string `json:"time_zone,omitempty"`
+
+	loc      *time.Location
+	schedule cron.Schedule
+	duration time.Duration
+	days     [7]bool
+	start    time.Duration
+	end      time.Duration
+}
+
+// parseTimeOfDay parses an HH:MM time of day as the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("%s is not a HH:MM time", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%s is not a HH:MM time", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// parseDays parses weekdays and weekday ranges.
+func parseDays(days []string) ([7]bool, error) {
+	var out [7]bool
+	if len(days) == 0 {
+		for i := range out {
+			out[i] = true
+		}
+		return out, nil
+	}
+	for _, d := range days {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(d)), "-")
+		f, ok := weekdays[from]
+		if !ok {
+			return out, fmt.Errorf("%s is not a weekday", d)
+		}
+		t := f
+		if isRange {
+			if t, ok = weekdays[to]; !ok {
+				return out, fmt.Errorf("%s is not a weekday range", d)
+			}
+		}
+		for wd := f; ; wd = (wd + 1) % 7 {
+			out[wd] = true
+			if wd == t {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// parse checks the window and prepares it for Contains.
+func (w *TimeWindow) parse() error {
+	var err error
+	if w.loc, err = time.LoadLocation(w.TimeZone); err != nil {
+		return fmt.Errorf("time_zone %s is invalid", w.TimeZone)
+	}
+	if w.Cron != "" {
+		if len(w.Days) > 0 || w.Start != "" || w.End != "" {
+			return errors.New("cron can not be combined with days, start and end")
+		}
+		if w.schedule, err = cron.ParseStandard(w.Cron); err != nil {
+			return fmt.Errorf("cron %s is invalid: %w", w.Cron, err)
+		}
+		if w.duration, err = time.ParseDuration(w.Duration); err != nil || w.duration <= 0 {
+			return errors.New("duration must be a positive duration such as 8h for a cron window")
+		}
+		return nil
+	}
+	if w.Duration != "" {
+		return errors.New("duration requires cron")
+	}
+	if w.days, err = parseDays(w.Days); err != nil {
+		return err
+	}
+	if w.Start == "" || w.End == "" {
+		return errors.New("start and end are required")
+	}
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		return err
+	}
+	if w.start == w.end {
+		return errors.New("start and end must differ")
+	}
+	return nil
+}
+
+// Validate checks the window and prepares it for Contains.
+func (w *TimeWindow) Validate() error {
+	return w.parse()
+}
+
+// Contains reports whether t is in the window. The window must have been
+// validated.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	if w.schedule != nil {
+		// the window is open if it started less than its duration ago
+		return !w.schedule.Next(t.Add(-w.duration)).After(t)
+	}
+	// the wall clock time of day, which elapsed time since midnight is not
+	// on days with a DST change
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start < w.end {
+		return w.days[t.Weekday()] && tod >= w.start && tod < w.end
+	}
+	// the window wraps past midnight, into the day after its start day
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && tod >= w.start) || (w.days[yesterday] && tod < w.end)
+}
+
+func (r *SignRequest) validateWindows() error {
+	if r.NotBefore < 0 {
+		return errors.New("not_before must be equal or greater than 0")
+	}
+	if r.NotBefore > 0 && r.ExpiresAt > 0 && r.NotBefore >= r.ExpiresAt {
+		return errors.New("not_before must be before expires_at")
+	}
+	for i := range r.Windows {
+		if err := r.Windows[i].parse(); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkWindows returns nil if now is after the request's not_before and in
+// one of its windows, with skew tolerance either way.
+func (r *SignRequest) checkWindows(now time.Time, skew time.Duration) error {
+	if r.NotBefore > 0 && now.Add(skew).Before(time.Unix(r.NotBefore, 0)) {
+		return fmt.Errorf("%w: request is not valid before %s", ErrOutsideWindow, time.Unix(r.NotBefore, 0).UTC().Format(time.RFC3339))
+	}
+	if len(r.Windows) == 0 {
+		return nil
+	}
+	for i := range r.Windows {
+		w := &r.Windows[i]
+		if err := w.parse(); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+		if w.Contains(now) || w.Contains(now.Add(-skew)) || w.Contains(now.Add(skew)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: request is outside of its time windows", ErrOutsideWindow)
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	business := TimeWindow{Days: []string{"mon-fri"}, Start: "09:00", End: "17:00"}
+	night := TimeWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}
+	daily := TimeWindow{Start: "09:00", End: "17:00", TimeZone: "America/New_York"}
+	allDay := TimeWindow{Days: []string{"sat-sun"}, Start: "00:00", End: "24:00"}
+	cronWindow := TimeWindow{Cron: "0 9 * * 1-5", Duration: "1h"}
+	tests := []struct {
+		name   string
+		window TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		// 2023-03-10 is a friday
+		{"in business hours", business, at(time.UTC, "2023-03-10 12:00"), true},
+		{"at start", business, at(time.UTC, "2023-03-10 09:00"), true},
+		{"at end", business, at(time.UTC, "2023-03-10 17:00"), false},
+		{"before start", business, at(time.UTC, "2023-03-10 08:59"), false},
+		{"weekend", business, at(time.UTC, "2023-03-11 12:00"), false},
+		{"other zone", business, at(ny, "2023-03-10 06:00"), true},
+		{"wrap before midnight", night, at(time.UTC, "2023-03-10 23:00"), true},
+		{"wrap after midnight", night, at(time.UTC, "2023-03-11 01:59"), true},
+		{"wrap at end", night, at(time.UTC, "2023-03-11 02:00"), false},
+		{"wrap from other day", night, at(time.UTC, "2023-03-10 01:00"), false},
+		{"wrap on other day", night, at(time.UTC, "2023-03-11 23:00"), false},
+		{"end of day", allDay, at(time.UTC, "2023-03-11 23:59"), true},
+		{"start of day", allDay, at(time.UTC, "2023-03-12 00:00"), true},
+		// DST starts on 2023-03-12 and ends on 2023-11-05 in New York
+		{"dst start in window", daily, at(ny, "2023-03-12 09:30"), true},
+		{"dst start before window", daily, at(ny, "2023-03-12 08:30"), false},
+		{"dst start end of window", daily, at(ny, "2023-03-12 16:30"), true},
+		{"dst end in window", daily, at(ny, "2023-11-05 09:30"), true},
+		{"dst end after window", daily, at(ny, "2023-11-05 17:30"), false},
+		{"dst end end of window", daily, at(ny, "2023-11-05 16:30"), true},
+		{"cron open", cronWindow, at(time.UTC, "2023-03-10 09:30"), true},
+		{"cron closed", cronWindow, at(time.UTC, "2023-03-10 10:00"), false},
+		{"cron weekend", cronWindow, at(time.UTC, "2023-03-11 09:30"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.window
+			if err := w.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindowValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		window TimeWindow
+	}{
+		{"missing end", TimeWindow{Start: "09:00"}},
+		{"same start and end", TimeWindow{Start: "09:00", End: "09:00"}},
+		{"invalid time", TimeWindow{Start: "9:00", End: "17:00"}},
+		{"after midnight", TimeWindow{Start: "09:00", End: "24:30"}},
+		{"invalid day", TimeWindow{Days: []string{"someday"}, Start: "09:00", End: "17:00"}},
+		{"invalid zone", TimeWindow{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus"}},
+		{"cron without duration", TimeWindow{Cron: "0 9 * * *"}},
+		{"cron with days", TimeWindow{Cron: "0 9 * * *", Duration: "1h", Days: []string{"mon"}}},
+		{"duration without cron", TimeWindow{Start: "09:00", End: "17:00", Duration: "1h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); err == nil {
+				t.Error("Validate() accepted an invalid window")
+			}
+		})
+	}
+}